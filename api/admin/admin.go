@@ -0,0 +1,171 @@
+// Package admin serves the endpoints operators use to inspect and control a running
+// blunderbuss: profiling, goroutine dumps, metrics, the effective config, the log
+// level and pausing ingest. They are served by a listener of their own, loopback only by
+// default, and must never be mounted on the public api's router.
+//
+// Importing net/http/pprof registers its handlers on http.DefaultServeMux. Nothing
+// in blunderbuss serves the default mux, so they are only reachable through here
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+
+	"github.com/StabbyCutyou/blunderbuss/config"
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"github.com/gorilla/mux"
+)
+
+// Config is the configuration for the Server struct
+type Config struct {
+	// Address to listen on, as host:port
+	Address string
+	// Config is the effective config, displayed with its secrets masked
+	Config        *config.Config
+	IngestControl services.IIngestControl
+	// Metrics is optional, when set it is served at /metrics
+	Metrics http.Handler
+}
+
+// Server serves the admin endpoints
+type Server struct {
+	Config *Config
+	Router *mux.Router
+	Server *http.Server
+}
+
+// New initializes a new admin server
+func New(cfg *Config) (*Server, error) {
+	s := &Server{
+		Config: cfg,
+		Router: mux.NewRouter(),
+	}
+	s.Server = &http.Server{Handler: s.Router}
+
+	r := s.Router
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// Index also serves each named profile, such as /debug/pprof/heap
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	r.HandleFunc("/debug/goroutines", s.goroutines).Methods("GET")
+	if cfg.Metrics != nil {
+		r.Handle("/metrics", cfg.Metrics).Methods("GET")
+	}
+
+	r.HandleFunc("/config", s.effectiveConfig).Methods("GET")
+	r.HandleFunc("/log-level", s.logLevel).Methods("GET")
+	r.HandleFunc("/log-level", s.setLogLevel).Methods("PUT")
+	r.HandleFunc("/ingest", s.ingestStatus).Methods("GET")
+	r.HandleFunc("/ingest/pause", s.pauseIngest).Methods("POST")
+	r.HandleFunc("/ingest/resume", s.resumeIngest).Methods("POST")
+	return s, nil
+}
+
+// Listen will serve requests until the server fails, or Shutdown is called. A
+// clean shutdown returns nil
+func (s *Server) Listen() error {
+	l, err := net.Listen("tcp", s.Config.Address)
+	if err != nil {
+		return err
+	}
+	if addr, ok := l.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		logging.Warnf("Blunderbuss admin endpoints are listening on %s, which is not a loopback address", l.Addr())
+	} else {
+		logging.Infof("Blunderbuss admin endpoints listening on %s", l.Addr())
+	}
+	if err = s.Server.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops the server, waiting for in flight requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.Server.Shutdown(ctx)
+}
+
+// goroutines dumps the stack of every goroutine, in the same format as an
+// unrecovered panic
+func (s *Server) goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func (s *Server) effectiveConfig(w http.ResponseWriter, r *http.Request) {
+	if s.Config.Config == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Config.Config.Masked())
+}
+
+// logLevelBody is the body of the log level endpoints
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+func (s *Server) logLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logLevelBody{Level: logging.CurrentLevel().String()})
+}
+
+func (s *Server) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body logLevelBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Malformed body: " + err.Error()})
+		return
+	}
+	l, err := logging.ParseLevel(body.Level)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	prev := logging.CurrentLevel()
+	logging.SetLevel(l)
+	// Logged at error so that it is written whatever the new level is
+	logging.Errorf("log level changed from %s to %s by %s", prev, l, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, logLevelBody{Level: l.String()})
+}
+
+func (s *Server) ingestStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": s.paused()})
+}
+
+func (s *Server) pauseIngest(w http.ResponseWriter, r *http.Request) {
+	s.setIngestPaused(w, r, true)
+}
+
+func (s *Server) resumeIngest(w http.ResponseWriter, r *http.Request) {
+	s.setIngestPaused(w, r, false)
+}
+
+func (s *Server) setIngestPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if s.Config.IngestControl == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "Ingest can not be paused"})
+		return
+	}
+	if paused {
+		s.Config.IngestControl.Pause()
+		logging.Warnf("ingest paused by %s", r.RemoteAddr)
+	} else {
+		s.Config.IngestControl.Resume()
+		logging.Warnf("ingest resumed by %s", r.RemoteAddr)
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": s.paused()})
+}
+
+func (s *Server) paused() bool {
+	return s.Config.IngestControl != nil && s.Config.IngestControl.Paused()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
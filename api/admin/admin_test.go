@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/config"
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// do sends a request to s, and decodes the json response into v if it is not nil
+func do(t *testing.T, s *Server, method, path, body string, v interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %s", method, path, err)
+		}
+	}
+	return w.Code
+}
+
+func TestIngestControls(t *testing.T) {
+	ic := services.NewIngestControl()
+	s, err := New(&Config{IngestControl: ic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status map[string]bool
+	if code := do(t, s, "POST", "/ingest/pause", "", &status); code != http.StatusOK || !status["paused"] || !ic.Paused() {
+		t.Fatalf("expected ingest to be paused, got %d and %v", code, status)
+	}
+	if code := do(t, s, "GET", "/ingest", "", &status); code != http.StatusOK || !status["paused"] {
+		t.Fatalf("expected ingest to be reported paused, got %d and %v", code, status)
+	}
+	if code := do(t, s, "POST", "/ingest/resume", "", &status); code != http.StatusOK || status["paused"] || ic.Paused() {
+		t.Fatalf("expected ingest to be resumed, got %d and %v", code, status)
+	}
+
+	s, err = New(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := do(t, s, "POST", "/ingest/pause", "", nil); code != http.StatusNotImplemented {
+		t.Fatalf("expected pausing without a control to be unsupported, got %d", code)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	defer logging.SetLevel(logging.CurrentLevel())
+	s, err := New(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body logLevelBody
+	if code := do(t, s, "PUT", "/log-level", `{"level":"debug"}`, &body); code != http.StatusOK || body.Level != "debug" || logging.CurrentLevel() != logging.LevelDebug {
+		t.Fatalf("expected the level to be changed to debug, got %d and %v", code, body)
+	}
+	if code := do(t, s, "GET", "/log-level", "", &body); code != http.StatusOK || body.Level != "debug" {
+		t.Fatalf("expected the level to be reported as debug, got %d and %v", code, body)
+	}
+	for _, bad := range []string{`{"level":"loud"}`, `not json`} {
+		if code := do(t, s, "PUT", "/log-level", bad, nil); code != http.StatusBadRequest || logging.CurrentLevel() != logging.LevelDebug {
+			t.Fatalf("expected %s to be refused, got %d", bad, code)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	s, err := New(&Config{Config: &config.Config{DBConnString: "postgres://blunderbuss:hunter2@db/blunderbuss"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg map[string]interface{}
+	if code := do(t, s, "GET", "/config", "", &cfg); code != http.StatusOK || cfg["DB_CONN_STRING"] != "********" {
+		t.Fatalf("expected the config with its secrets masked, got %d and %v", code, cfg)
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/goroutines"} {
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine") {
+			t.Fatalf("expected %s to be served, got %d", path, w.Code)
+		}
+	}
+	// Without a metrics handler, there's no metrics route
+	if code := do(t, s, "GET", "/metrics", "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected no metrics, got %d", code)
+	}
+}
@@ -1 +1,234 @@
+// Package http holds the server every version of the http api is served from.
+// Each version lives in its own package (v1, v2, ...) and registers its routes
+// with the Server under its own /v{n} prefix, so that several versions may be
+// served side by side from one process
 package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/StabbyCutyou/blunderbuss/logging"
+)
+
+// API is implemented by each version of the http api
+type API interface {
+	// Version is the number the api is served under, as in /v{Version}
+	Version() int
+	// RegisterRoutes adds the api's routes to router, which is already scoped
+	// to the api's /v{Version} prefix
+	RegisterRoutes(router *mux.Router)
+}
+
+// NotFounder is implemented by apis which report unknown routes themselves. Each
+// reports those under its own prefix, and the first one registered handles every
+// other request that matches no route
+type NotFounder interface {
+	NotFoundHandler() http.Handler
+}
+
+// VersionOptions control how a registered version is served
+type VersionOptions struct {
+	// Deprecated versions respond with a Deprecation header
+	Deprecated bool
+	// DeprecatedAt is optional, when set it is sent as the Deprecation date
+	DeprecatedAt time.Time
+	// Sunset is optional, when set it is sent in a Sunset header to tell clients
+	// when the version will be removed
+	Sunset time.Time
+}
+
+// Config is the configuration for the Server struct
+type Config struct {
+	Port int
+	// TLS is optional, when it is enabled the api is only served over TLS
+	TLS *TLSConfig
+}
+
+// Server serves every registered version of the http api
+type Server struct {
+	Config   *Config
+	Router   *mux.Router
+	Server   *http.Server
+	versions map[int]API
+}
+
+// New initializes a new server with no versions registered
+func New(config *Config) (*Server, error) {
+	// Create a gorilla mux
+	router := mux.NewRouter()
+	// Strict Slash is documented here: http://www.gorillatoolkit.org/pkg/mux#Router.StrictSlash
+	// It means we will try to match /path and /path/
+	router.StrictSlash(true)
+
+	s := &Server{
+		Config:   config,
+		Router:   router,
+		Server:   &http.Server{Handler: router},
+		versions: make(map[int]API),
+	}
+	if config.TLS.Enabled() {
+		tlsConfig, err := NewTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		s.Server.TLSConfig = tlsConfig
+	}
+	return s, nil
+}
+
+// Register mounts api under /v{n}. Each version may only be registered once
+func (s *Server) Register(api API, opts *VersionOptions) error {
+	v := api.Version()
+	if _, ok := s.versions[v]; ok {
+		return fmt.Errorf("HTTP api version %d is already registered", v)
+	}
+	s.versions[v] = api
+	if nf, ok := api.(NotFounder); ok && s.Router.NotFoundHandler == nil {
+		s.Router.NotFoundHandler = nf.NotFoundHandler()
+	}
+
+	// Each version gets a router of its own, so that everything under its prefix,
+	// including requests which match none of its routes, goes through the handler
+	// wrapped around it
+	prefix := "/v" + strconv.Itoa(v)
+	router := mux.NewRouter()
+	router.StrictSlash(true)
+	if nf, ok := api.(NotFounder); ok {
+		router.NotFoundHandler = nf.NotFoundHandler()
+	}
+	api.RegisterRoutes(router.PathPrefix(prefix).Subrouter())
+
+	var h http.Handler = router
+	if opts != nil && opts.Deprecated {
+		h = deprecationHeaders(opts, h)
+	}
+	s.Router.PathPrefix(prefix + "/").Handler(h)
+	return nil
+}
+
+// Versions lists the registered versions, in ascending order
+func (s *Server) Versions() []int {
+	versions := make([]int, 0, len(s.versions))
+	for v := range s.versions {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// deprecationHeaders marks every response from a deprecated version, following
+// RFC 9745 (Deprecation) and RFC 8594 (Sunset)
+func deprecationHeaders(opts *VersionOptions, next http.Handler) http.Handler {
+	deprecation := "true"
+	if !opts.DeprecatedAt.IsZero() {
+		deprecation = "@" + strconv.FormatInt(opts.DeprecatedAt.Unix(), 10)
+	}
+	sunset := ""
+	if !opts.Sunset.IsZero() {
+		sunset = opts.Sunset.UTC().Format(http.TimeFormat)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", deprecation)
+		if sunset != "" {
+			w.Header().Set("Sunset", sunset)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Listen will serve requests until the server fails, or Shutdown is called. A
+// clean shutdown returns nil
+func (s *Server) Listen() error {
+	s.Server.Addr = fmt.Sprintf("0.0.0.0:%d", s.Config.Port)
+
+	var err error
+	if s.Server.TLSConfig != nil {
+		logging.Infof("Blunderbuss listening on %s with TLS, serving versions %v", s.Server.Addr, s.Versions())
+		// The certificate comes from TLSConfig.GetCertificate, so no files are given here
+		err = s.Server.ListenAndServeTLS("", "")
+	} else {
+		logging.Infof("Blunderbuss listening on %s, serving versions %v", s.Server.Addr, s.Versions())
+		err = s.Server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting new connections, and waits for in flight requests to
+// finish until ctx is done. Use RegisterOnShutdown to end long lived requests,
+// such as streams, so they don't hold the shutdown up
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.Server.Shutdown(ctx)
+}
+
+// RegisterOnShutdown registers a function to call when Shutdown is called
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.Server.RegisterOnShutdown(f)
+}
+
+// ParseVersionOptions reads which versions are deprecated, and when they sunset,
+// from their config values. deprecated is in the form "1=2026-10-01,2", where the
+// date is optional, and sunset in the form "1=2027-06-30". A sunset implies the
+// version is deprecated
+func ParseVersionOptions(deprecated, sunset string) (map[int]*VersionOptions, error) {
+	opts := make(map[int]*VersionOptions)
+	get := func(v int) *VersionOptions {
+		if opts[v] == nil {
+			opts[v] = &VersionOptions{Deprecated: true}
+		}
+		return opts[v]
+	}
+
+	err := parseVersionDates(deprecated, true, func(v int, t time.Time) {
+		get(v).DeprecatedAt = t
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = parseVersionDates(sunset, false, func(v int, t time.Time) {
+		get(v).Sunset = t
+	})
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// parseVersionDates calls set for each "version=date" pair in s. The date may only
+// be left out when optionalDate is true, in which case set gets the zero time
+func parseVersionDates(s string, optionalDate bool, set func(int, time.Time)) error {
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		version, date := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			version, date = strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		}
+		v, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+		if err != nil || v < 1 {
+			return fmt.Errorf("Invalid HTTP api version %q", version)
+		}
+		var t time.Time
+		if date != "" {
+			if t, err = time.Parse("2006-01-02", date); err != nil {
+				return fmt.Errorf("Invalid date for HTTP api version %d: %s", v, err)
+			}
+		} else if !optionalDate {
+			return fmt.Errorf("Missing date for HTTP api version %d", v)
+		}
+		set(v, t)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// fakeAPI serves GET /thing, and reports unknown routes with its version
+type fakeAPI struct {
+	version int
+}
+
+func (f *fakeAPI) Version() int {
+	return f.version
+}
+
+func (f *fakeAPI) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/thing", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("thing"))
+	}).Methods("GET")
+}
+
+func (f *fakeAPI) NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Not-Found-By", strconv.Itoa(f.version))
+		w.WriteHeader(http.StatusNotFound)
+	})
+}
+
+func TestServerRegister(t *testing.T) {
+	s, err := New(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deprecatedAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+	if err = s.Register(&fakeAPI{version: 1}, &VersionOptions{Deprecated: true, DeprecatedAt: deprecatedAt, Sunset: sunset}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Register(&fakeAPI{version: 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Register(&fakeAPI{version: 2}, nil); err == nil {
+		t.Fatal("expected registering version 2 twice to fail")
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		wantStatus     int
+		wantNotFoundBy string
+		wantDeprecated bool
+	}{
+		{name: "deprecated route", method: "GET", path: "/v1/thing", wantStatus: http.StatusOK, wantDeprecated: true},
+		{name: "deprecated version's unknown route", method: "GET", path: "/v1/nothing", wantStatus: http.StatusNotFound, wantNotFoundBy: "1", wantDeprecated: true},
+		{name: "deprecated version's wrong method", method: "POST", path: "/v1/thing", wantStatus: http.StatusMethodNotAllowed, wantDeprecated: true},
+		{name: "current route", method: "GET", path: "/v2/thing", wantStatus: http.StatusOK},
+		{name: "current version's unknown route", method: "GET", path: "/v2/nothing", wantStatus: http.StatusNotFound, wantNotFoundBy: "2"},
+		{name: "unregistered version", method: "GET", path: "/v10/thing", wantStatus: http.StatusNotFound, wantNotFoundBy: "1"},
+		{name: "outside every version", method: "GET", path: "/thing", wantStatus: http.StatusNotFound, wantNotFoundBy: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.Router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("X-Not-Found-By"); got != tt.wantNotFoundBy {
+				t.Fatalf("expected not found to be reported by %q, got %q", tt.wantNotFoundBy, got)
+			}
+			deprecation, sunsetHeader := w.Header().Get("Deprecation"), w.Header().Get("Sunset")
+			if !tt.wantDeprecated {
+				if deprecation != "" || sunsetHeader != "" {
+					t.Fatalf("expected no deprecation headers, got %q and %q", deprecation, sunsetHeader)
+				}
+				return
+			}
+			if deprecation != "@"+strconv.FormatInt(deprecatedAt.Unix(), 10) || sunsetHeader != "Wed, 30 Jun 2027 00:00:00 GMT" {
+				t.Fatalf("unexpected deprecation headers %q and %q", deprecation, sunsetHeader)
+			}
+		})
+	}
+
+	if got := s.Versions(); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("expected versions [1 2], got %v", got)
+	}
+}
+
+// freePort returns a port nothing is listening on
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestListenReturnsErrors(t *testing.T) {
+	l, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := New(&Config{Port: l.Addr().(*net.TCPAddr).Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Listen(); err == nil {
+		t.Fatal("expected an error listening on a port in use")
+	}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	port := freePort(t)
+	s, err := New(&Config{Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	listened := make(chan error, 1)
+	go func() { listened <- s.Listen() }()
+
+	url := "http://127.0.0.1:" + strconv.Itoa(port) + "/slow"
+	responded := make(chan error, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		// Retry until the server is listening
+		for i := 0; i < 100; i++ {
+			if resp, err = http.Get(url); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			responded <- err
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err == nil && string(b) != "done" {
+			err = fmt.Errorf("unexpected body %q", b)
+		}
+		responded <- err
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	// New connections are refused while the request in flight is waited for
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if i == 100 {
+			t.Fatal("expected new connections to be refused")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown finished with a request in flight: %v", err)
+	default:
+	}
+
+	close(release)
+	if err = <-responded; err != nil {
+		t.Fatalf("request in flight failed: %s", err)
+	}
+	if err = <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	// A clean shutdown isn't an error
+	if err = <-listened; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/logging"
+)
+
+const (
+	// ClientAuthNone does not ask clients for a certificate
+	ClientAuthNone = "none"
+	// ClientAuthOptional verifies a client certificate if one is sent
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire refuses connections without a valid client certificate
+	ClientAuthRequire = "require"
+)
+
+// DefaultCertReloadInterval is used when TLSConfig.ReloadInterval is not set
+const DefaultCertReloadInterval = 10 * time.Second
+
+// TLSConfig configures serving over TLS. It is only used when CertFile and KeyFile
+// are both set
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the CAs used to verify client certificates, for mutual TLS.
+	// Unlike the certificate it is only read at startup, so changing it needs a restart
+	ClientCAFile string
+	// ClientAuth is one of ClientAuthNone, ClientAuthOptional or ClientAuthRequire
+	ClientAuth string
+	// ReloadInterval is how often the certificate files are checked for changes
+	ReloadInterval time.Duration
+}
+
+// Enabled reports whether a certificate has been configured
+func (c *TLSConfig) Enabled() bool {
+	return c != nil && c.CertFile != "" && c.KeyFile != ""
+}
+
+// NewTLSConfig builds the tls.Config for a server, loading the certificate
+// through a certReloader so it can be rotated without a restart
+func NewTLSConfig(c *TLSConfig) (*tls.Config, error) {
+	reloader, err := newCertReloader(c.CertFile, c.KeyFile, c.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	switch c.ClientAuth {
+	case "", ClientAuthNone:
+		return cfg, nil
+	case ClientAuthOptional:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("Unknown TLS client auth mode %q", c.ClientAuth)
+	}
+
+	if c.ClientCAFile == "" {
+		return nil, fmt.Errorf("TLS client auth mode %q needs a client CA file", c.ClientAuth)
+	}
+	pem, err := ioutil.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in %s", c.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	return cfg, nil
+}
+
+// certReloader serves a certificate from disk, reloading it when the files change.
+// Files are checked at most once per interval, during a handshake. Any change to
+// their modification time counts, so that rolling back to an older certificate,
+// which may bring back an older time, is picked up too
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+	// modTimes are those of the certificate and key files when they were loaded
+	modTimes  [2]time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	if interval <= 0 {
+		interval = DefaultCertReloadInterval
+	}
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate satisfies tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastCheck) >= r.interval {
+		r.lastCheck = time.Now()
+		if modTimes, err := r.fileModTimes(); err == nil && !sameTimes(modTimes, r.modTimes) {
+			if err := r.load(); err != nil {
+				// Keep serving the certificate we have, it's better than nothing
+				logging.Warnf("unable to reload TLS certificate: %s", err)
+			} else {
+				logging.Infof("reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// load reads the certificate and key. The caller must hold mu, or be the constructor
+func (r *certReloader) load() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	return nil
+}
+
+func (r *certReloader) fileModTimes() ([2]time.Time, error) {
+	var times [2]time.Time
+	for i, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return times, err
+		}
+		times[i] = info.ModTime()
+	}
+	return times, nil
+}
+
+func sameTimes(a, b [2]time.Time) bool {
+	return a[0].Equal(b[0]) && a[1].Equal(b[1])
+}
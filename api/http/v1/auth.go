@@ -0,0 +1,31 @@
+package httpv1
+
+import (
+	"net/http"
+
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1/middleware"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// authorizeApplication checks that the request's API key may access events for app.
+// When keys are not enforced every application is allowed
+func authorizeApplication(r *http.Request, app string) error {
+	k := middleware.APIKeyFromRequest(r)
+	if k == nil || k.AllowsApplication(app) {
+		return nil
+	}
+	return services.ErrForbidden
+}
+
+// scopeSearch restricts a search to the applications the request's API key may read
+func scopeSearch(r *http.Request, p *services.EventSearchParams) error {
+	k := middleware.APIKeyFromRequest(r)
+	if k == nil {
+		return nil
+	}
+	if p.Application != "" && !k.AllowsApplication(p.Application) {
+		return services.ErrForbidden
+	}
+	p.Applications = k.Applications
+	return nil
+}
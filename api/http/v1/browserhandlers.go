@@ -0,0 +1,53 @@
+package httpv1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1/middleware"
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
+
+// RecordBrowserEvents accepts events sent straight from web pages, including those
+// sent with navigator.sendBeacon, which always posts a text/plain body. The body
+// may be a single event, a JSON array of events, or newline delimited JSON
+func (h *HTTPApi) RecordBrowserEvents(w http.ResponseWriter, r *http.Request) {
+	b, err := h.readBody(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var items []json.RawMessage
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed) {
+		items = []json.RawMessage{trimmed}
+	} else if items, err = splitBatch(trimmed, r.Header.Get("Content-Type")); err != nil {
+		writeError(w, r, errBadRequest("Malformed events", err))
+		return
+	}
+	if err = h.Middleware.LimitRequest(r, len(items)); err != nil {
+		h.recordRejected("", err, len(items))
+		writeError(w, r, err)
+		return
+	}
+
+	k := middleware.APIKeyFromRequest(r)
+	now := time.Now().UTC()
+	results, err := h.logBatch(r, items, func(e *models.Event) {
+		// Pages often leave these out, so fill them in from what we know
+		if e.CreatedAt.Unix() == 0 {
+			e.CreatedAt = now
+		}
+		if e.Application == "" && k != nil && len(k.Applications) == 1 {
+			e.Application = k.Applications[0]
+		}
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "results": results})
+}
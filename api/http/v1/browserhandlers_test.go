@@ -0,0 +1,63 @@
+package httpv1
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordBrowserEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantStatus  int
+		wantApps    []string
+	}{
+		// sendBeacon posts a string as text/plain
+		{name: "beacon with one event", body: `{"type":"error","message":"undefined is not a function"}`, contentType: "text/plain;charset=UTF-8", wantStatus: http.StatusOK, wantApps: []string{"shop"}},
+		{name: "beacon with an array", body: `[{"type":"error"},{"application":"shop","type":"error"}]`, contentType: "text/plain", wantStatus: http.StatusOK, wantApps: []string{"shop", "shop"}},
+		{name: "ndjson", body: "{\"type\":\"error\"}\n{\"type\":\"error\"}\n", contentType: "application/x-ndjson", wantStatus: http.StatusOK, wantApps: []string{"shop", "shop"}},
+		{name: "malformed", body: `[{"type":"error"`, contentType: "text/plain", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &fakeEventService{}
+			// The certificate limits the caller to a single application, which
+			// events that leave theirs out are filed under
+			h, err := New(&Config{EventService: es, ClientCertApplications: map[string][]string{"shop-frontend": {"shop"}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("POST", "/v1/browser/events", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Header.Set("Origin", "https://shop.example.com")
+			leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "shop-frontend"}}
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+			w := httptest.NewRecorder()
+			h.NewRouter().ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if w.Header().Get("Access-Control-Allow-Origin") != "https://shop.example.com" {
+				t.Fatalf("expected the origin to be allowed, got %v", w.Header())
+			}
+
+			if len(es.stored) != len(tt.wantApps) {
+				t.Fatalf("expected %d events stored, got %d: %s", len(tt.wantApps), len(es.stored), w.Body)
+			}
+			for i, e := range es.stored {
+				if e.Application != tt.wantApps[i] || e.CreatedAt.IsZero() || e.CreatedAt.Unix() == 0 {
+					t.Fatalf("expected event %d to be filled in, got %+v", i, e)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package httpv1
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultMaxBodySize is used when Config.MaxBodySize is not set
+const DefaultMaxBodySize = 5 << 20
+
+// DefaultMaxDecompressedBodySize is used when Config.MaxDecompressedBodySize is not set
+const DefaultMaxDecompressedBodySize = 10 << 20
+
+// minCompressSize is the smallest response we'll bother compressing
+const minCompressSize = 1024
+
+const (
+	encodingGzip     = "gzip"
+	encodingZstd     = "zstd"
+	encodingIdentity = "identity"
+)
+
+// errBodyTooLarge is returned when a compressed body expands past the configured limit
+var errBodyTooLarge = services.NewError(services.CodeTooLarge, "Decompressed request body too large")
+
+// readBody reads and closes the request body, decompressing it according to the
+// Content-Encoding header. Both the size as sent, and the decompressed size are
+// capped, the latter to guard against decompression bombs
+func (h *HTTPApi) readBody(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+
+	maxBody := h.Config.MaxBodySize
+	if maxBody <= 0 {
+		maxBody = DefaultMaxBodySize
+	}
+	if r.ContentLength > maxBody {
+		return nil, services.NewError(services.CodeTooLarge, "Request body too large")
+	}
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBody)
+
+	limit := h.Config.MaxDecompressedBodySize
+	if limit <= 0 {
+		limit = DefaultMaxDecompressedBodySize
+	}
+
+	var body io.Reader
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", encodingIdentity:
+		body = r.Body
+	case encodingGzip:
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, errBadRequest("Malformed gzip body", err)
+		}
+		defer gz.Close()
+		body = gz
+	case encodingZstd:
+		zr, err := zstd.NewReader(r.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(limit)))
+		if err != nil {
+			return nil, errBadRequest("Malformed zstd body", err)
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, services.NewError(services.CodeInvalidRequest, "Unsupported Content-Encoding: "+encoding)
+	}
+
+	// Read one byte past the limit, so we can tell a body that is exactly the limit
+	// apart from one that is over it
+	b, err := ioutil.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, errBodyTooLarge
+		}
+		return nil, errReadingBody(err)
+	}
+	if int64(len(b)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return b, nil
+}
+
+// writeCompressedJSON writes v as json, compressed with the best encoding the
+// client accepts. Small responses are sent uncompressed
+func writeCompressedJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logging.Errorf("unable to marshal response: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if len(b) < minCompressSize || encoding == encodingIdentity {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(b)
+		return
+	}
+
+	var buf bytes.Buffer
+	switch encoding {
+	case encodingGzip:
+		gz := gzip.NewWriter(&buf)
+		gz.Write(b)
+		gz.Close()
+	case encodingZstd:
+		zw, _ := zstd.NewWriter(&buf, zstd.WithEncoderConcurrency(1))
+		zw.Write(b)
+		zw.Close()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// negotiateEncoding picks the response encoding with the highest q value in an
+// Accept-Encoding header, preferring zstd over gzip when they are equal
+func negotiateEncoding(header string) string {
+	best, bestQ := encodingIdentity, 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		switch name {
+		case encodingZstd:
+			if q >= bestQ {
+				best, bestQ = encodingZstd, q
+			}
+		case encodingGzip, "*":
+			if q > bestQ {
+				best, bestQ = encodingGzip, q
+			}
+		}
+	}
+	return best
+}
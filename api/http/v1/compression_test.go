@@ -0,0 +1,148 @@
+package httpv1
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdCompressed(t *testing.T, b []byte, opts ...zstd.EOption) []byte {
+	w, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return w.EncodeAll(b, nil)
+}
+
+func TestReadBody(t *testing.T) {
+	const limit = 4096
+	small := bytes.Repeat([]byte("a"), limit)
+	large := bytes.Repeat([]byte("a"), 64*limit)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     []byte
+		wantCode services.ErrorCode
+	}{
+		{name: "identity", body: small, want: small},
+		{name: "identity over the limit", body: large, wantCode: services.CodeTooLarge},
+		{name: "gzip", encoding: "gzip", body: gzipped(t, small), want: small},
+		{name: "gzip over the limit", encoding: "gzip", body: gzipped(t, large), wantCode: services.CodeTooLarge},
+		{name: "malformed gzip", encoding: "gzip", body: []byte("not gzip"), wantCode: services.CodeInvalidRequest},
+		{name: "zstd", encoding: "zstd", body: zstdCompressed(t, small), want: small},
+		{name: "zstd over the limit", encoding: "zstd", body: zstdCompressed(t, large), wantCode: services.CodeTooLarge},
+		{name: "zstd window over the limit", encoding: "zstd", body: zstdCompressed(t, large, zstd.WithWindowSize(1<<20), zstd.WithSingleSegment(false)), wantCode: services.CodeTooLarge},
+		{name: "unsupported encoding", encoding: "br", body: small, wantCode: services.CodeInvalidRequest},
+	}
+	h := &HTTPApi{Config: &Config{MaxDecompressedBodySize: limit}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/v1/events/batch", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+			b, err := h.readBody(r)
+			if tt.wantCode != "" {
+				if services.ErrorCodeOf(err) != tt.wantCode {
+					t.Fatalf("expected a %s error, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !bytes.Equal(b, tt.want) {
+				t.Fatalf("expected %d bytes, got %d", len(tt.want), len(b))
+			}
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: encodingIdentity},
+		{header: "gzip", want: encodingGzip},
+		{header: "gzip, zstd", want: encodingZstd},
+		{header: "zstd, gzip", want: encodingZstd},
+		{header: "zstd;q=0.5, gzip;q=0.8", want: encodingGzip},
+		{header: "GZIP;q=0.3", want: encodingGzip},
+		{header: "*", want: encodingGzip},
+		{header: "gzip;q=0, zstd;q=0", want: encodingIdentity},
+		{header: "br, deflate", want: encodingIdentity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteCompressedJSON(t *testing.T) {
+	large := map[string]string{"message": strings.Repeat("a", 2*minCompressSize)}
+	small := map[string]string{"message": "a"}
+
+	tests := []struct {
+		name         string
+		accept       string
+		v            map[string]string
+		wantEncoding string
+	}{
+		{name: "uncompressed", v: large},
+		{name: "gzip", accept: "gzip", v: large, wantEncoding: encodingGzip},
+		{name: "zstd", accept: "gzip, zstd", v: large, wantEncoding: encodingZstd},
+		{name: "too small to compress", accept: "gzip", v: small},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/events", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			writeCompressedJSON(w, r, http.StatusOK, tt.v)
+			if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != tt.wantEncoding || w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Fatalf("expected %d encoded as %q, got %d with headers %v", http.StatusOK, tt.wantEncoding, w.Code, w.Header())
+			}
+
+			// Decoding the body with the request handling gives back what was written
+			decode := httptest.NewRequest("PUT", "/", bytes.NewReader(w.Body.Bytes()))
+			decode.Header.Set("Content-Encoding", tt.wantEncoding)
+			b, err := (&HTTPApi{Config: &Config{}}).readBody(decode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]string
+			if err = json.Unmarshal(b, &got); err != nil || !reflect.DeepEqual(got, tt.v) {
+				t.Fatalf("body did not round trip: %v", err)
+			}
+		})
+	}
+}
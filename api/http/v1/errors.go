@@ -0,0 +1,112 @@
+package httpv1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1/middleware"
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// errorResponse is the body returned for every failed request
+type errorResponse struct {
+	Code      services.ErrorCode `json:"code"`
+	Message   string             `json:"message"`
+	Details   interface{}        `json:"details"`
+	RequestID string             `json:"request_id"`
+}
+
+// statusForCode maps a service error code onto the http status we report it as
+var statusForCode = map[services.ErrorCode]int{
+	services.CodeInvalidRequest:   http.StatusBadRequest,
+	services.CodeUnauthorized:     http.StatusUnauthorized,
+	services.CodeForbidden:        http.StatusForbidden,
+	services.CodeNotFound:         http.StatusNotFound,
+	services.CodeNotAcceptable:    http.StatusNotAcceptable,
+	services.CodeTooLarge:         http.StatusRequestEntityTooLarge,
+	services.CodeValidationFailed: http.StatusUnprocessableEntity,
+	services.CodeRateLimited:      http.StatusTooManyRequests,
+	services.CodeUnavailable:      http.StatusServiceUnavailable,
+	services.CodeInternal:         http.StatusInternalServerError,
+}
+
+// errBadRequest wraps an error caused by input we could not understand
+func errBadRequest(message string, err error) error {
+	return services.WrapError(services.CodeInvalidRequest, message, err)
+}
+
+// errReadingBody classifies a failure to read a request body
+func errReadingBody(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return services.WrapError(services.CodeTooLarge, "Request body too large", err)
+	}
+	return errBadRequest("Unable to read request body", err)
+}
+
+// notFound reports unknown routes using the same envelope as every other error
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, services.NewError(services.CodeNotFound, "No such route"))
+}
+
+// writeError writes the error envelope for err. Errors that aren't a services.Error
+// are treated as internal faults, and their message is logged rather than returned
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	resp := errorResponse{
+		Code:      services.CodeInternal,
+		Message:   "Internal server error",
+		RequestID: requestID(w, r),
+	}
+
+	var e *services.Error
+	if errors.As(err, &e) {
+		resp.Code = e.Code
+		resp.Message = e.Message
+		resp.Details = e.Details
+		if e.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(e.RetryAfterSeconds()))
+		}
+		if resp.Details == nil && e.Err != nil && e.Code != services.CodeInternal && e.Code != services.CodeUnavailable {
+			resp.Details = e.Err.Error()
+		}
+	}
+
+	status, ok := statusForCode[resp.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	if status >= 500 {
+		logging.Errorf("request %s failed: %s", resp.RequestID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeJSON writes v as the json body of a response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logging.Errorf("unable to marshal response: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// requestID returns the id the RequestID middleware assigned to the request. For
+// the rare response written outside of the middleware stack, one is generated
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := middleware.RequestIDFromRequest(r); id != "" {
+		return id
+	}
+	id := middleware.NewRequestID()
+	w.Header().Set("X-Request-ID", id)
+	return id
+}
@@ -0,0 +1,104 @@
+package httpv1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantCode       services.ErrorCode
+		wantMessage    string
+		wantDetails    interface{}
+		wantRetryAfter string
+	}{
+		{
+			name:       "bad input",
+			err:        errBadRequest("Malformed event", errors.New("unexpected end of JSON input")),
+			wantStatus: http.StatusBadRequest, wantCode: services.CodeInvalidRequest,
+			wantMessage: "Malformed event", wantDetails: "unexpected end of JSON input",
+		},
+		{
+			name:       "validation failure",
+			err:        &services.Error{Code: services.CodeValidationFailed, Message: "Event is missing required fields", Details: []services.FieldError{{Path: "/type", Message: "is required"}}},
+			wantStatus: http.StatusUnprocessableEntity, wantCode: services.CodeValidationFailed,
+			wantMessage: "Event is missing required fields", wantDetails: []interface{}{map[string]interface{}{"path": "/type", "message": "is required"}},
+		},
+		{
+			name:       "not found",
+			err:        services.ErrEventNotFound,
+			wantStatus: http.StatusNotFound, wantCode: services.CodeNotFound, wantMessage: "Event not found",
+		},
+		{
+			name:       "too large",
+			err:        errReadingBody(&http.MaxBytesError{Limit: 10}),
+			wantStatus: http.StatusRequestEntityTooLarge, wantCode: services.CodeTooLarge,
+			wantMessage: "Request body too large", wantDetails: "http: request body too large",
+		},
+		{
+			name:       "rate limited",
+			err:        &services.Error{Code: services.CodeRateLimited, Message: "Rate limit exceeded", RetryAfter: 1500 * time.Millisecond},
+			wantStatus: http.StatusTooManyRequests, wantCode: services.CodeRateLimited,
+			wantMessage: "Rate limit exceeded", wantRetryAfter: "2",
+		},
+		// The causes of server side failures are logged, not returned
+		{
+			name:       "database down",
+			err:        services.WrapError(services.CodeUnavailable, "Database unavailable", errors.New("dial tcp 10.0.0.1:5432: connection refused")),
+			wantStatus: http.StatusServiceUnavailable, wantCode: services.CodeUnavailable, wantMessage: "Database unavailable",
+		},
+		{
+			name:       "wrapped",
+			err:        fmt.Errorf("logging event: %w", services.ErrForbidden),
+			wantStatus: http.StatusForbidden, wantCode: services.CodeForbidden, wantMessage: services.ErrForbidden.Message,
+		},
+		{
+			name:       "unclassified",
+			err:        errors.New("password authentication failed for user blunderbuss"),
+			wantStatus: http.StatusInternalServerError, wantCode: services.CodeInternal, wantMessage: "Internal server error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, httptest.NewRequest("GET", "/", nil), tt.err)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if w.Header().Get("Retry-After") != tt.wantRetryAfter {
+				t.Fatalf("expected Retry-After %q, got %q", tt.wantRetryAfter, w.Header().Get("Retry-After"))
+			}
+
+			// Every error has the same shape, whatever went wrong
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"code", "message", "details", "request_id"} {
+				if _, ok := body[key]; !ok {
+					t.Fatalf("expected %q in %s", key, w.Body)
+				}
+			}
+			if len(body) != 4 {
+				t.Fatalf("unexpected keys in %s", w.Body)
+			}
+			if body["code"] != string(tt.wantCode) || body["message"] != tt.wantMessage || !reflect.DeepEqual(body["details"], tt.wantDetails) {
+				t.Fatalf("expected %s %q with details %v, got %s", tt.wantCode, tt.wantMessage, tt.wantDetails, w.Body)
+			}
+			if id, _ := body["request_id"].(string); id == "" || w.Header().Get("X-Request-ID") != id {
+				t.Fatalf("expected the request id in the body and headers, got %s and %q", w.Body, w.Header().Get("X-Request-ID"))
+			}
+		})
+	}
+}
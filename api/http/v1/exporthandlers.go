@@ -0,0 +1,309 @@
+package httpv1
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	exportNDJSON = "application/x-ndjson"
+	exportCSV    = "text/csv"
+)
+
+const (
+	// exportContextJSON writes the context of each event as a single column of JSON
+	exportContextJSON = "json"
+	// exportContextFlatten writes a column for each leaf of the context, named by
+	// its dotted path
+	exportContextFlatten = "flatten"
+)
+
+// exportColumns are the CSV columns every export has, ahead of any for context
+var exportColumns = []string{"id", "application", "type", "message", "stack_trace", "created_at", "truncated_fields"}
+
+// ExportEvents streams every event matching the search, taken from the query string
+// as in SearchEvents. The format is chosen by the Accept header, newline delimited
+// JSON or CSV. For CSV, context=flatten writes each context key to its own column,
+// either those listed in context_keys or every key the matching events have
+func (h *HTTPApi) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	format, ok := negotiateExportFormat(r.Header.Get("Accept"))
+	if !ok {
+		writeError(w, r, services.NewError(services.CodeNotAcceptable, "Exports are available as "+exportNDJSON+" or "+exportCSV))
+		return
+	}
+
+	q := r.URL.Query()
+	p, err := searchParamsFromQuery(q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err = scopeSearch(r, p); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var contextKeys []string
+	switch q.Get("context") {
+	case "", exportContextJSON:
+	case exportContextFlatten:
+		if format != exportCSV {
+			break
+		}
+		contextKeys = splitQueryList(q.Get("context_keys"))
+		if len(contextKeys) == 0 {
+			if contextKeys, err = h.Config.EventService.ContextKeys(r.Context(), p); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+	default:
+		writeError(w, r, invalidQuery("Invalid context: %s, must be one of %s or %s", q.Get("context"), exportContextJSON, exportContextFlatten))
+		return
+	}
+
+	// Nothing is written until the first event arrives, so that a search which
+	// fails outright can still be reported with the usual error
+	var ew eventWriter
+	var closeBody func() error
+	start := func() {
+		w.Header().Set("Content-Type", format)
+		w.Header().Add("Vary", "Accept, Accept-Encoding")
+		var body io.Writer
+		body, closeBody = compressStream(w, r)
+		w.WriteHeader(http.StatusOK)
+		if format == exportCSV {
+			ew = newCSVEventWriter(body, q.Get("context") == exportContextFlatten, contextKeys)
+		} else {
+			ew = newNDJSONEventWriter(body)
+		}
+	}
+
+	err = h.Config.EventService.ExportEvents(r.Context(), p, q.Get("order"), func(e *models.Event) error {
+		if ew == nil {
+			start()
+		}
+		return ew.Write(e)
+	})
+	if err != nil && ew == nil {
+		writeError(w, r, err)
+		return
+	}
+	if err != nil {
+		// The status has already been sent, so the only way left to tell the client
+		// the export is incomplete is to break the connection
+		logging.Errorf("export failed part way request_id=%s: %s", requestID(w, r), err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if ew == nil {
+		start()
+	}
+	if err = ew.Flush(); err == nil {
+		err = closeBody()
+	}
+	if err != nil {
+		logging.Errorf("export failed to finish request_id=%s: %s", requestID(w, r), err)
+	}
+}
+
+// negotiateExportFormat picks the export format with the highest q value in an
+// Accept header. No header, or a wildcard, gets newline delimited JSON
+func negotiateExportFormat(header string) (string, bool) {
+	if strings.TrimSpace(header) == "" {
+		return exportNDJSON, true
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 || q <= bestQ {
+			continue
+		}
+		switch name {
+		case exportNDJSON, "application/jsonl", "application/*", "*/*":
+			best, bestQ = exportNDJSON, q
+		case exportCSV, "text/*":
+			best, bestQ = exportCSV, q
+		}
+	}
+	return best, best != ""
+}
+
+// compressStream wraps w in the best encoding the client accepts. The returned
+// func must be called once everything has been written
+func compressStream(w http.ResponseWriter, r *http.Request) (io.Writer, func() error) {
+	switch negotiateEncoding(r.Header.Get("Accept-Encoding")) {
+	case encodingGzip:
+		w.Header().Set("Content-Encoding", encodingGzip)
+		gz := gzip.NewWriter(w)
+		return gz, gz.Close
+	case encodingZstd:
+		w.Header().Set("Content-Encoding", encodingZstd)
+		zw, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		return zw, zw.Close
+	}
+	return w, func() error { return nil }
+}
+
+func splitQueryList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// eventWriter writes events out one at a time in some export format
+type eventWriter interface {
+	Write(e *models.Event) error
+	// Flush writes out anything still buffered
+	Flush() error
+}
+
+type ndjsonEventWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONEventWriter(w io.Writer) *ndjsonEventWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonEventWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+// Write writes e as a single line of JSON. The encoder ends each value with a newline
+func (nw *ndjsonEventWriter) Write(e *models.Event) error {
+	return nw.enc.Encode(e)
+}
+
+func (nw *ndjsonEventWriter) Flush() error {
+	return nw.buf.Flush()
+}
+
+type csvEventWriter struct {
+	csv         *csv.Writer
+	flatten     bool
+	contextKeys []string
+	wroteHeader bool
+	record      []string
+	leaves      map[string]string
+}
+
+func newCSVEventWriter(w io.Writer, flatten bool, contextKeys []string) *csvEventWriter {
+	return &csvEventWriter{
+		csv:         csv.NewWriter(w),
+		flatten:     flatten,
+		contextKeys: contextKeys,
+		leaves:      make(map[string]string),
+	}
+}
+
+func (cw *csvEventWriter) writeHeader() error {
+	cw.wroteHeader = true
+	header := append([]string{}, exportColumns...)
+	if !cw.flatten {
+		header = append(header, "context")
+	}
+	for _, k := range cw.contextKeys {
+		header = append(header, "context."+k)
+	}
+	return cw.csv.Write(header)
+}
+
+// Write writes e as a single CSV record. Context keys e doesn't have are left empty
+func (cw *csvEventWriter) Write(e *models.Event) error {
+	if !cw.wroteHeader {
+		if err := cw.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	cw.record = append(cw.record[:0],
+		e.ID,
+		e.Application,
+		e.Type,
+		e.Message,
+		e.StackTrace,
+		e.CreatedAt.UTC().Format(time.RFC3339),
+		strings.Join(e.Truncated, ","),
+	)
+	if !cw.flatten {
+		cw.record = append(cw.record, string(e.Context))
+		return cw.csv.Write(cw.record)
+	}
+
+	for k := range cw.leaves {
+		delete(cw.leaves, k)
+	}
+	if len(e.Context) > 0 {
+		d := json.NewDecoder(strings.NewReader(string(e.Context)))
+		d.UseNumber()
+		var ctxt interface{}
+		if err := d.Decode(&ctxt); err != nil {
+			return err
+		}
+		flattenContext("", ctxt, cw.leaves)
+	}
+	for _, k := range cw.contextKeys {
+		cw.record = append(cw.record, cw.leaves[k])
+	}
+	return cw.csv.Write(cw.record)
+}
+
+func (cw *csvEventWriter) Flush() error {
+	if !cw.wroteHeader {
+		if err := cw.writeHeader(); err != nil {
+			return err
+		}
+	}
+	cw.csv.Flush()
+	return cw.csv.Error()
+}
+
+// flattenContext records each leaf of v in leaves under its dotted path. Arrays are
+// leaves, and are written as JSON
+func flattenContext(path string, v interface{}, leaves map[string]string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if path != "" {
+				k = path + "." + k
+			}
+			flattenContext(k, child, leaves)
+		}
+	case nil:
+		leaves[path] = ""
+	case string:
+		leaves[path] = val
+	case json.Number:
+		leaves[path] = val.String()
+	case bool:
+		leaves[path] = strconv.FormatBool(val)
+	default:
+		b, _ := json.Marshal(val)
+		leaves[path] = string(b)
+	}
+}
@@ -0,0 +1,174 @@
+package httpv1
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+func TestNegotiateExportFormat(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{header: "", want: exportNDJSON, ok: true},
+		{header: "*/*", want: exportNDJSON, ok: true},
+		{header: "text/csv", want: exportCSV, ok: true},
+		{header: "application/x-ndjson;q=0.5, text/csv", want: exportCSV, ok: true},
+		{header: "text/csv;q=0.2, application/jsonl", want: exportNDJSON, ok: true},
+		{header: "text/*", want: exportCSV, ok: true},
+		{header: "application/json"},
+		{header: "text/csv;q=0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok := negotiateExportFormat(tt.header)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("expected %q, %v, got %q, %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestCSVEventWriter(t *testing.T) {
+	created := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	events := []*models.Event{
+		{ID: "1", Application: "billing", Type: "error", Message: "a, \"quoted\"\nmessage", CreatedAt: created, Truncated: []string{"message", "context"}, Context: []byte(`{"user":{"id":7,"admin":false},"tags":["a","b"]}`)},
+		{ID: "2", Application: "billing", Type: "error", CreatedAt: created, Context: []byte(`{"user":{"id":8},"region":null}`)},
+	}
+	common := []string{"id", "application", "type", "message", "stack_trace", "created_at", "truncated_fields"}
+	row := func(e *models.Event, rest ...string) []string {
+		return append([]string{e.ID, e.Application, e.Type, e.Message, "", "2026-03-04T05:06:07Z", strings.Join(e.Truncated, ",")}, rest...)
+	}
+
+	tests := []struct {
+		name    string
+		flatten bool
+		keys    []string
+		events  []*models.Event
+		want    [][]string
+	}{
+		{
+			name:   "context as json",
+			events: events,
+			want:   [][]string{append(common, "context"), row(events[0], string(events[0].Context)), row(events[1], string(events[1].Context))},
+		},
+		{
+			name:    "flattened context",
+			flatten: true,
+			keys:    []string{"region", "tags", "user.admin", "user.id"},
+			events:  events,
+			want: [][]string{
+				append(common, "context.region", "context.tags", "context.user.admin", "context.user.id"),
+				row(events[0], "", `["a","b"]`, "false", "7"),
+				row(events[1], "", "", "", "8"),
+			},
+		},
+		// Even an empty export has a header, so it opens as a spreadsheet
+		{name: "no events", want: [][]string{append(common, "context")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			cw := newCSVEventWriter(&buf, tt.flatten, tt.keys)
+			for _, e := range tt.events {
+				if err := cw.Write(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := cw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExportEvents(t *testing.T) {
+	stored := []*models.Event{
+		{ID: "1", Application: "billing", Type: "error", Context: []byte(`{"user":7}`)},
+		{ID: "2", Application: "billing", Type: "error", Context: []byte(`{"user":8}`)},
+	}
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		stored      []*models.Event
+		exportErr   error
+		wantStatus  int
+		wantType    string
+		wantBody    string
+		wantAborted bool
+	}{
+		{
+			name: "ndjson", query: "?application=billing", stored: stored,
+			wantStatus: http.StatusOK, wantType: exportNDJSON,
+			wantBody: "{\"id\":\"1\"", // each event on its own line, checked below
+		},
+		{
+			name: "flattened csv with discovered keys", query: "?application=billing&context=flatten", accept: "text/csv", stored: stored,
+			wantStatus: http.StatusOK, wantType: exportCSV,
+			wantBody: "id,application,type,message,stack_trace,created_at,truncated_fields,context.user\n",
+		},
+		{name: "unsupported format", query: "?application=billing", accept: "application/json", wantStatus: http.StatusNotAcceptable},
+		{name: "invalid context mode", query: "?application=billing&context=nested", accept: "text/csv", wantStatus: http.StatusBadRequest},
+		{name: "failing before any events", query: "?application=billing", exportErr: services.ErrNoSearchValues, wantStatus: http.StatusUnprocessableEntity},
+		{name: "failing part way", query: "?application=billing", stored: stored, exportErr: errors.New("connection reset"), wantStatus: http.StatusOK, wantAborted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &fakeEventService{stored: tt.stored, exportErr: tt.exportErr, contextKeys: []string{"user"}}
+			h, err := New(&Config{EventService: es})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", "/v1/events/export"+tt.query, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			aborted := func() (aborted bool) {
+				// The connection is broken by panicking, which net/http recovers from
+				defer func() {
+					if p := recover(); p != nil {
+						if p != http.ErrAbortHandler {
+							panic(p)
+						}
+						aborted = true
+					}
+				}()
+				h.NewRouter().ServeHTTP(w, r)
+				return false
+			}()
+			if w.Code != tt.wantStatus || aborted != tt.wantAborted {
+				t.Fatalf("expected status %d, aborted %v, got %d, %v: %s", tt.wantStatus, tt.wantAborted, w.Code, aborted, w.Body)
+			}
+			if tt.wantType == "" {
+				return
+			}
+			if w.Header().Get("Content-Type") != tt.wantType || !strings.HasPrefix(w.Body.String(), tt.wantBody) {
+				t.Fatalf("expected %s starting %q, got %s: %s", tt.wantType, tt.wantBody, w.Header().Get("Content-Type"), w.Body)
+			}
+			if lines := strings.Count(w.Body.String(), "\n"); tt.wantType == exportNDJSON && lines != len(tt.stored) || tt.wantType == exportCSV && lines != len(tt.stored)+1 {
+				t.Fatalf("expected a line per event, got %q", w.Body)
+			}
+		})
+	}
+}
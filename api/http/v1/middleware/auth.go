@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// APIKeyFromRequest returns the key the request was authenticated with, or nil if
+// keys are not being enforced
+func APIKeyFromRequest(r *http.Request) *models.APIKey {
+	k, _ := r.Context().Value(apiKeyContextKey).(*models.APIKey)
+	return k
+}
+
+// Ingest requires the request to carry a key which may write events. The API key
+// and client IP rate limits are charged by the handler, once it knows how many
+// events the request holds
+func (m *Manager) Ingest(rh RequestHandler) RequestHandler {
+	return m.authenticate(m.pausable(rh), (*models.APIKey).CanIngest)
+}
+
+// Read requires the request to carry a key which may query events
+func (m *Manager) Read(rh RequestHandler) RequestHandler {
+	return m.authenticate(rh, (*models.APIKey).CanRead)
+}
+
+// Admin requires the request to carry a key which may delete events
+func (m *Manager) Admin(rh RequestHandler) RequestHandler {
+	return m.authenticate(rh, (*models.APIKey).CanDelete)
+}
+
+// authenticate checks the request's key, and that allowed says it may be used for
+// the route
+func (m *Manager) authenticate(rh RequestHandler, allowed func(*models.APIKey) bool) RequestHandler {
+	if !m.keysEnforced() && len(m.ClientCertApplications) == 0 {
+		return rh
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		k, err := m.Authorize(bearerToken(r), r.TLS, allowed)
+		if err != nil {
+			if services.ErrorCodeOf(err) == services.CodeUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="blunderbuss"`)
+			}
+			m.WriteError(w, r, err)
+			return
+		}
+		if k != nil {
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, k))
+		}
+		rh(w, r)
+	}
+}
+
+// Authorize works out who the caller is from their raw API key and the state of
+// their TLS connection, which may be nil, and checks that allowed says they may
+// do what they asked. It is used outside of the http api as well, so that every
+// api authenticates the same way. A nil key means neither keys nor client
+// certificates are being enforced, and every application is allowed. When keys
+// aren't enforced but certificates are mapped to applications, callers without
+// a verified certificate are refused
+func (m *Manager) Authorize(rawKey string, state *tls.ConnectionState, allowed func(*models.APIKey) bool) (*models.APIKey, error) {
+	var k *models.APIKey
+	if m.keysEnforced() {
+		var err error
+		if k, err = m.KeyService.Authenticate(rawKey); err != nil {
+			return nil, err
+		}
+	}
+
+	apps, ok := m.clientCertApplications(state)
+	if !ok && k == nil && len(m.ClientCertApplications) > 0 {
+		// Without a key, the certificate is the only thing saying which applications
+		// the caller may access, so going without one can't mean access to all of them
+		return nil, services.ErrUnauthorized
+	}
+	if ok {
+		if k == nil {
+			k = &models.APIKey{Scope: models.ScopeReadWrite}
+		} else {
+			// Take a copy, as the key service may share keys between requests
+			scoped := *k
+			k = &scoped
+			apps = intersect(k.Applications, apps)
+		}
+		if len(apps) == 0 {
+			return nil, services.ErrForbidden
+		}
+		k.Applications = apps
+	}
+
+	if k != nil && !allowed(k) {
+		return nil, services.ErrForbidden
+	}
+	return k, nil
+}
+
+func (m *Manager) keysEnforced() bool {
+	return m.RequireAPIKeys && m.KeyService != nil
+}
+
+// clientCertApplications returns the applications mapped to the CN and SANs of the
+// connection's verified client certificate. ok is false if there is no such certificate
+func (m *Manager) clientCertApplications(state *tls.ConnectionState) (apps []string, ok bool) {
+	if len(m.ClientCertApplications) == 0 || state == nil || len(state.VerifiedChains) == 0 {
+		return nil, false
+	}
+	leaf := state.VerifiedChains[0][0]
+	names := append([]string{leaf.Subject.CommonName}, leaf.DNSNames...)
+	names = append(names, leaf.EmailAddresses...)
+	for _, u := range leaf.URIs {
+		names = append(names, u.String())
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		for _, app := range m.ClientCertApplications[name] {
+			if !seen[app] {
+				seen[app] = true
+				apps = append(apps, app)
+			}
+		}
+	}
+	return apps, true
+}
+
+func intersect(a, b []string) []string {
+	var out []string
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				out = append(out, x)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// ParseClientCertApplications reads a mapping of client certificate names to
+// applications, in the form "name=app1|app2,othername=app3"
+func ParseClientCertApplications(s string) (map[string][]string, error) {
+	m := make(map[string][]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid client certificate mapping %q, expected name=app1|app2", entry)
+		}
+		m[parts[0]] = append(m[parts[0]], strings.Split(parts[1], "|")...)
+	}
+	return m, nil
+}
+
+// pausable refuses writes while an operator has paused ingest
+func (m *Manager) pausable(rh RequestHandler) RequestHandler {
+	if m.IngestControl == nil {
+		return rh
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m.IngestControl.Paused() {
+			m.WriteError(w, r, services.ErrIngestPaused)
+			return
+		}
+		rh(w, r)
+	}
+}
+
+// LimitRequest charges n events to the request's API key and client IP rate
+// limits. It must be called after the request has been authenticated, so the key
+// is known
+func (m *Manager) LimitRequest(r *http.Request, n int) error {
+	return m.LimitClient(APIKeyFromRequest(r), clientIP(r), n)
+}
+
+// LimitClient charges n events to the rate limits of the API key k, which may be
+// nil, and of the client at ip
+func (m *Manager) LimitClient(k *models.APIKey, ip string, n int) error {
+	if m.RateLimiter == nil || n < 1 {
+		return nil
+	}
+	if k != nil && k.ID != "" {
+		if ok, wait := m.RateLimiter.Allow(services.RateLimitAPIKey, k.ID, n); !ok {
+			return services.NewRateLimitedError(services.RateLimitAPIKey, wait)
+		}
+	}
+	if ok, wait := m.RateLimiter.Allow(services.RateLimitIP, ip, n); !ok {
+		return services.NewRateLimitedError(services.RateLimitIP, wait)
+	}
+	return nil
+}
+
+// clientIP is the address of the connecting client, without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// bearerToken pulls the key out of an "Authorization: Bearer <key>" header
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// browserPreflightMaxAge is how long, in seconds, browsers may cache a preflight
+const browserPreflightMaxAge = "86400"
+
+// Browser authenticates requests coming directly from web pages, which can't set
+// an Authorization header. The public key is read from the key query parameter,
+// and the page's Origin must be one the key's project allows. Client certificates
+// are applied as they are on every other route, so when they decide access
+// without keys, callers without a mapped certificate are refused. CORS preflight
+// requests are answered here, and never reach rh
+func (m *Manager) Browser(rh RequestHandler) RequestHandler {
+	rh = m.pausable(rh)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+
+		k, err := m.Authorize(r.URL.Query().Get("key"), r.TLS, canReportFromBrowser)
+		if err != nil {
+			m.WriteError(w, r, err)
+			return
+		}
+		if m.keysEnforced() && !k.AllowsOrigin(origin) {
+			m.WriteError(w, r, services.ErrForbidden)
+			return
+		}
+
+		if origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding")
+			w.Header().Set("Access-Control-Max-Age", browserPreflightMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if k != nil {
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, k))
+		}
+		rh(w, r)
+	}
+}
+
+// canReportFromBrowser allows public keys, the only ones safe to embed in a page.
+// A caller known only by its client certificate has no key, so it is allowed too
+func canReportFromBrowser(k *models.APIKey) bool {
+	return k.Scope == models.ScopePublic || k.ID == ""
+}
@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// fakeKeyService knows a single key, "good"
+type fakeKeyService struct {
+	services.IAPIKeyService
+	key *models.APIKey
+}
+
+func (f *fakeKeyService) Authenticate(rawKey string) (*models.APIKey, error) {
+	if rawKey != "good" {
+		return nil, services.ErrUnauthorized
+	}
+	return f.key, nil
+}
+
+// verifiedState is a TLS connection whose client presented a verified certificate
+// with the given CN
+func verifiedState(cn string) *tls.ConnectionState {
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+}
+
+func TestAuthorize(t *testing.T) {
+	mapping := map[string][]string{"billing-svc": {"billing", "invoices"}}
+	readWrite := &models.APIKey{ID: "k1", Scope: models.ScopeReadWrite, Applications: []string{"billing", "search"}}
+	ingestOnly := &models.APIKey{ID: "k2", Scope: models.ScopeIngest, Applications: []string{"billing"}}
+
+	tests := []struct {
+		name     string
+		keys     bool
+		key      *models.APIKey
+		mapping  map[string][]string
+		rawKey   string
+		state    *tls.ConnectionState
+		allowed  func(*models.APIKey) bool
+		wantApps []string
+		wantNil  bool
+		wantErr  services.ErrorCode
+	}{
+		{name: "nothing enforced", allowed: (*models.APIKey).CanRead, wantNil: true},
+		{name: "mapping without a certificate", mapping: mapping, allowed: (*models.APIKey).CanRead, wantErr: services.CodeUnauthorized},
+		{name: "mapping with an unverified connection", mapping: mapping, state: &tls.ConnectionState{}, allowed: (*models.APIKey).CanRead, wantErr: services.CodeUnauthorized},
+		{name: "unmapped certificate", mapping: mapping, state: verifiedState("someone-else"), allowed: (*models.APIKey).CanRead, wantErr: services.CodeForbidden},
+		{name: "mapped certificate", mapping: mapping, state: verifiedState("billing-svc"), allowed: (*models.APIKey).CanRead, wantApps: []string{"billing", "invoices"}},
+		{name: "missing key", keys: true, key: readWrite, allowed: (*models.APIKey).CanRead, wantErr: services.CodeUnauthorized},
+		{name: "wrong key", keys: true, key: readWrite, rawKey: "bad", allowed: (*models.APIKey).CanRead, wantErr: services.CodeUnauthorized},
+		{name: "key", keys: true, key: readWrite, rawKey: "good", allowed: (*models.APIKey).CanRead, wantApps: []string{"billing", "search"}},
+		{name: "key out of scope", keys: true, key: ingestOnly, rawKey: "good", allowed: (*models.APIKey).CanRead, wantErr: services.CodeForbidden},
+		{name: "key without a certificate", keys: true, key: readWrite, mapping: mapping, rawKey: "good", allowed: (*models.APIKey).CanRead, wantApps: []string{"billing", "search"}},
+		{name: "key narrowed by certificate", keys: true, key: readWrite, mapping: mapping, rawKey: "good", state: verifiedState("billing-svc"), allowed: (*models.APIKey).CanRead, wantApps: []string{"billing"}},
+		{name: "key and certificate with nothing in common", keys: true, key: ingestOnly, mapping: map[string][]string{"billing-svc": {"search"}}, rawKey: "good", state: verifiedState("billing-svc"), allowed: (*models.APIKey).CanIngest, wantErr: services.CodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{RequireAPIKeys: tt.keys, ClientCertApplications: tt.mapping}
+			if tt.keys {
+				m.KeyService = &fakeKeyService{key: tt.key}
+			}
+			k, err := m.Authorize(tt.rawKey, tt.state, tt.allowed)
+			if tt.wantErr != "" {
+				if err == nil || services.ErrorCodeOf(err) != tt.wantErr {
+					t.Fatalf("expected a %s error, got key %v and error %v", tt.wantErr, k, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.wantNil {
+				if k != nil {
+					t.Fatalf("expected no key, got %v", k)
+				}
+				return
+			}
+			if k == nil || !reflect.DeepEqual([]string(k.Applications), tt.wantApps) {
+				t.Fatalf("expected applications %v, got %v", tt.wantApps, k)
+			}
+		})
+	}
+
+	// Narrowing a key must not change the one the key service shares between requests
+	if !reflect.DeepEqual([]string(readWrite.Applications), []string{"billing", "search"}) {
+		t.Fatalf("shared key was modified: %v", readWrite.Applications)
+	}
+}
+
+func TestLimitClient(t *testing.T) {
+	key := &models.APIKey{ID: "k1"}
+	tests := []struct {
+		name     string
+		key      *models.APIKey
+		ip       string
+		charges  []int
+		wantKind string
+	}{
+		{name: "within both limits", key: key, ip: "10.0.0.1", charges: []int{4, 6}},
+		{name: "key charged per event", key: key, ip: "10.0.0.1", charges: []int{10, 1}, wantKind: services.RateLimitAPIKey},
+		{name: "ip charged per event", ip: "10.0.0.1", charges: []int{20, 1}, wantKind: services.RateLimitIP},
+		{name: "keys with no id are only limited by ip", key: &models.APIKey{}, ip: "10.0.0.1", charges: []int{20}},
+		{name: "nothing to charge", key: key, ip: "10.0.0.1", charges: []int{10, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl, err := services.NewRateLimitService(&services.RateLimitServiceConfig{
+				APIKey: services.RateLimit{Rate: 1, Burst: 10},
+				IP:     services.RateLimit{Rate: 1, Burst: 20},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := &Manager{RateLimiter: rl}
+			for i, n := range tt.charges {
+				err = m.LimitClient(tt.key, tt.ip, n)
+				if last := i == len(tt.charges)-1; !last || tt.wantKind == "" {
+					if err != nil {
+						t.Fatalf("charge %d of %d: unexpected error: %s", i, n, err)
+					}
+					continue
+				}
+				se, ok := err.(*services.Error)
+				if !ok || se.Code != services.CodeRateLimited || se.Details.(map[string]interface{})["limit"] != tt.wantKind {
+					t.Fatalf("expected the %s limit to be hit, got %v", tt.wantKind, err)
+				}
+			}
+		})
+	}
+
+	// Without a rate limiter nothing is limited
+	if err := (&Manager{}).LimitClient(key, "10.0.0.1", 1000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestBrowser(t *testing.T) {
+	mapping := map[string][]string{"billing-svc": {"billing"}}
+	public := &models.APIKey{ID: "k1", Scope: models.ScopePublic, Applications: []string{"billing"}, AllowedOrigins: []string{"https://shop.example.com"}}
+	ingest := &models.APIKey{ID: "k2", Scope: models.ScopeIngest, Applications: []string{"billing"}, AllowedOrigins: []string{"*"}}
+
+	tests := []struct {
+		name     string
+		keys     bool
+		key      *models.APIKey
+		mapping  map[string][]string
+		method   string
+		rawKey   string
+		origin   string
+		state    *tls.ConnectionState
+		wantApps []string
+		wantErr  services.ErrorCode
+	}{
+		{name: "nothing enforced"},
+		{name: "preflight", method: http.MethodOptions, origin: "https://shop.example.com"},
+		{name: "mapping without a certificate", mapping: mapping, wantErr: services.CodeUnauthorized},
+		{name: "unmapped certificate", mapping: mapping, state: verifiedState("someone-else"), wantErr: services.CodeForbidden},
+		{name: "mapped certificate", mapping: mapping, state: verifiedState("billing-svc"), wantApps: []string{"billing"}},
+		{name: "missing key", keys: true, key: public, origin: "https://shop.example.com", wantErr: services.CodeUnauthorized},
+		{name: "public key", keys: true, key: public, rawKey: "good", origin: "https://shop.example.com", wantApps: []string{"billing"}},
+		{name: "public key from another origin", keys: true, key: public, rawKey: "good", origin: "https://evil.example.com", wantErr: services.CodeForbidden},
+		{name: "key that isn't public", keys: true, key: ingest, rawKey: "good", origin: "https://shop.example.com", wantErr: services.CodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotErr error
+			m := &Manager{
+				RequireAPIKeys:         tt.keys,
+				ClientCertApplications: tt.mapping,
+				WriteError: func(w http.ResponseWriter, r *http.Request, err error) {
+					gotErr = err
+				},
+			}
+			if tt.keys {
+				m.KeyService = &fakeKeyService{key: tt.key}
+			}
+			reached := false
+			var got *models.APIKey
+			h := m.Browser(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				got = APIKeyFromRequest(r)
+			})
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r := httptest.NewRequest(method, "/v1/browser/events?key="+tt.rawKey, nil)
+			r.TLS = tt.state
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+
+			if tt.wantErr != "" {
+				if reached || services.ErrorCodeOf(gotErr) != tt.wantErr {
+					t.Fatalf("expected a %s error, got %v", tt.wantErr, gotErr)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("unexpected error: %s", gotErr)
+			}
+			if method == http.MethodOptions {
+				if reached || w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != tt.origin {
+					t.Fatalf("expected the preflight to be answered, got %d and %v", w.Code, w.Header())
+				}
+				return
+			}
+			if !reached {
+				t.Fatal("expected the request to reach the handler")
+			}
+			if tt.wantApps == nil {
+				if got != nil {
+					t.Fatalf("expected no key, got %v", got)
+				}
+				return
+			}
+			if got == nil || !reflect.DeepEqual([]string(got.Applications), tt.wantApps) {
+				t.Fatalf("expected applications %v, got %v", tt.wantApps, got)
+			}
+		})
+	}
+}
+
+func TestIngestPaused(t *testing.T) {
+	ic := services.NewIngestControl()
+	var gotErr error
+	m := &Manager{IngestControl: ic, WriteError: func(w http.ResponseWriter, r *http.Request, err error) {
+		gotErr = err
+	}}
+	reached := 0
+	rh := func(w http.ResponseWriter, r *http.Request) { reached++ }
+	ingest, read := m.Ingest(rh), m.Read(rh)
+
+	ic.Pause()
+	ingest(httptest.NewRecorder(), httptest.NewRequest("PUT", "/v1/event", nil))
+	if reached != 0 || gotErr != services.ErrIngestPaused {
+		t.Fatalf("expected writes to be refused while paused, got %v", gotErr)
+	}
+	// Reads carry on while ingest is paused
+	read(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/events", nil))
+	if reached != 1 {
+		t.Fatal("expected reads to be served while paused")
+	}
+
+	ic.Resume()
+	ingest(httptest.NewRecorder(), httptest.NewRequest("PUT", "/v1/event", nil))
+	if reached != 2 {
+		t.Fatal("expected writes to be accepted once resumed")
+	}
+}
@@ -13,22 +13,82 @@ import (
 // Manager is
 type Manager struct {
 	StatsClient services.StatsdClient
+	KeyService  services.IAPIKeyService
+	// RequireAPIKeys turns on enforcement of API keys. When it is false, requests
+	// are let through without a key
+	RequireAPIKeys bool
+	// WriteError reports a failure to the caller, so that middleware responds with
+	// the same shape of error as the handlers it wraps
+	WriteError func(http.ResponseWriter, *http.Request, error)
+	// ClientCertApplications maps the CN or a SAN of a verified client certificate
+	// to the applications that client may access
+	ClientCertApplications map[string][]string
+	// RateLimiter is optional, when set ingest is limited per API key and client IP
+	RateLimiter services.IRateLimitService
+	// Prometheus is optional, when set request metrics are recorded there as well
+	Prometheus *services.PrometheusMetrics
+	// IngestControl is optional, when set writes are refused while it is paused
+	IngestControl services.IIngestControl
+}
+
+// ManagerConfig is
+type ManagerConfig struct {
+	StatsClient    services.StatsdClient
+	KeyService     services.IAPIKeyService
+	RequireAPIKeys bool
+	WriteError     func(http.ResponseWriter, *http.Request, error)
+
+	ClientCertApplications map[string][]string
+	RateLimiter            services.IRateLimitService
+	Prometheus             *services.PrometheusMetrics
+	IngestControl          services.IIngestControl
 }
 
 // Change th to accept in any of the dependencies, and assign it to a property
 // on the Manager
 
 // NewManager is
-func NewManager(s services.StatsdClient) (*Manager, error) {
-	return &Manager{StatsClient: s}, nil
+func NewManager(cfg *ManagerConfig) (*Manager, error) {
+	return &Manager{
+		StatsClient:    cfg.StatsClient,
+		KeyService:     cfg.KeyService,
+		RequireAPIKeys: cfg.RequireAPIKeys,
+		WriteError:     cfg.WriteError,
+
+		ClientCertApplications: cfg.ClientCertApplications,
+		RateLimiter:            cfg.RateLimiter,
+		Prometheus:             cfg.Prometheus,
+		IngestControl:          cfg.IngestControl,
+	}, nil
 }
 
 // RequestHandler is
 type RequestHandler func(http.ResponseWriter, *http.Request)
 
-// Run will invoke the middleware in whatever order we decide
-func (m *Manager) Run(rh RequestHandler) RequestHandler {
-	// We could construct any kind of advanced, conditional middleware chaining
-	// we might need from here
-	return rh
+// Middleware wraps a RequestHandler with some behavior of its own
+type Middleware func(RequestHandler) RequestHandler
+
+// Chain composes middleware into one. The first middleware given is the outermost,
+// so it sees the request first and the response last
+func Chain(mws ...Middleware) Middleware {
+	return func(rh RequestHandler) RequestHandler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			rh = mws[i](rh)
+		}
+		return rh
+	}
+}
+
+// Run will wrap rh in the standard stack every route gets: request ids, panic
+// recovery, access logging and metrics, all labelled with route. Any middleware
+// the route opts into is run inside of that, in the order given
+func (m *Manager) Run(route string, rh RequestHandler, stack ...Middleware) RequestHandler {
+	return Chain(append(m.Standard(route), stack...)...)(rh)
+}
+
+// Standard is the stack of middleware Run applies to every route. Recover is the
+// innermost, so a panic is still logged and measured as a 500. Routes that need
+// something different can build their own with Chain
+func (m *Manager) Standard(route string) []Middleware {
+	return []Middleware{m.RequestID, m.AccessLog(route), m.Metrics(route), m.Recover}
 }
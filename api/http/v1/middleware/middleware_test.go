@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mark := func(name string) Middleware {
+		return func(rh RequestHandler) RequestHandler {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+" in")
+				rh(w, r)
+				calls = append(calls, name+" out")
+			}
+		}
+	}
+	h := Chain(mark("outer"), mark("inner"))(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	want := []string{"outer in", "inner in", "handler", "inner out", "outer out"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected %v, got %v", want, calls)
+	}
+}
+
+func TestRunAppliesRouteStack(t *testing.T) {
+	m := &Manager{}
+	var seenID string
+	// A route's own middleware runs inside the standard stack, so it can rely on
+	// the request id having been assigned
+	routeMW := func(rh RequestHandler) RequestHandler {
+		return func(w http.ResponseWriter, r *http.Request) {
+			seenID = RequestIDFromRequest(r)
+			w.Header().Set("X-Route", "yes")
+			rh(w, r)
+		}
+	}
+	h := m.Run("things", func(w http.ResponseWriter, r *http.Request) {}, routeMW)
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/", nil))
+	if seenID == "" || w.Header().Get("X-Request-ID") != seenID || w.Header().Get("X-Route") != "yes" {
+		t.Fatalf("expected the route's middleware to run with a request id, got %q and %v", seenID, w.Header())
+	}
+}
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+type contextKey int
+
+const (
+	apiKeyContextKey contextKey = iota
+	requestIDContextKey
+)
+
+// maxRequestIDLength bounds the X-Request-ID we'll accept from a caller
+const maxRequestIDLength = 128
+
+// RequestIDFromRequest returns the id assigned to the request by the RequestID
+// middleware, or the empty string if it didn't run
+func RequestIDFromRequest(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// RequestID gives each request an id, taken from the X-Request-ID header when the
+// caller sent a reasonable one, and generated otherwise. The id is echoed back in
+// the response's X-Request-ID header
+func (m *Manager) RequestID(rh RequestHandler) RequestHandler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		rh(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id)))
+	}
+}
+
+// NewRequestID generates a random request id
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID only allows ids that are safe to write into the logs as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Recover turns a panic in rh into a 500, rather than letting it take down the
+// connection. If the response had already started there is nothing more to send
+func (m *Manager) Recover(rh RequestHandler) RequestHandler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := wrapResponseWriter(w)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			logging.Errorf("panic serving %s %s request_id=%s: %v\n%s", r.Method, r.URL.Path, RequestIDFromRequest(r), p, debug.Stack())
+			if !rec.wroteHeader {
+				m.WriteError(rec, r, services.NewError(services.CodeInternal, "Internal server error"))
+			}
+		}()
+		rh(rec, r)
+	}
+}
+
+// AccessLog writes a line per request, as space separated key=value pairs
+func (m *Manager) AccessLog(route string) Middleware {
+	return func(rh RequestHandler) RequestHandler {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := wrapResponseWriter(w)
+			rh(rec, r)
+			logging.Infof("access method=%s route=%s path=%s status=%d bytes=%d duration_ms=%.3f remote=%s request_id=%s",
+				r.Method, route, strconv.Quote(r.URL.Path), rec.Status(), rec.bytes,
+				float64(time.Since(start))/float64(time.Millisecond), clientIP(r), RequestIDFromRequest(r))
+		}
+	}
+}
+
+// Metrics reports the latency and status of every request to the route
+func (m *Manager) Metrics(route string) Middleware {
+	return func(rh RequestHandler) RequestHandler {
+		if m.StatsClient == nil && m.Prometheus == nil {
+			return rh
+		}
+		prefix := "http." + statName(route) + "."
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := wrapResponseWriter(w)
+			rh(rec, r)
+			took := time.Since(start)
+			if m.StatsClient != nil {
+				m.StatsClient.PrecisionTiming(prefix+"latency", took)
+				m.StatsClient.Incr(prefix+"status."+strconv.Itoa(rec.Status()), 1)
+			}
+			m.Prometheus.ObserveRequest(route, r.Method, rec.Status(), took)
+		}
+	}
+}
+
+// statName makes a route name safe to use as part of a statsd key
+func statName(route string) string {
+	return strings.NewReplacer(".", "_", "/", "_", ":", "_", " ", "_").Replace(strings.Trim(route, "/"))
+}
+
+// responseRecorder remembers the status and size of a response as it is written.
+// It passes Flush and Hijack through, so streaming handlers still work when wrapped
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+// wrapResponseWriter returns w if it is already a responseRecorder, so stacking
+// middleware doesn't stack recorders
+func wrapResponseWriter(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+// Status is the status code that was written, defaulting to 200 as net/http does
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("Hijacking is not supported")
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// fakeStats remembers the keys each stat was sent under
+type fakeStats struct {
+	services.StatsdClient
+	mu      sync.Mutex
+	counts  map[string]int64
+	timings map[string]bool
+}
+
+func (f *fakeStats) Incr(id string, value int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[id] += value
+	return nil
+}
+
+func (f *fakeStats) PrecisionTiming(id string, value time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.timings[id] = true
+	return nil
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "none sent"},
+		{name: "sent", header: "req-1234", keep: true},
+		{name: "too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+		{name: "unsafe to log", header: "req 1234\nlevel=error"},
+	}
+	m := &Manager{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := m.RequestID(func(w http.ResponseWriter, r *http.Request) {
+				got = RequestIDFromRequest(r)
+			})
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if got == "" || w.Header().Get("X-Request-ID") != got {
+				t.Fatalf("expected the request id %q to be echoed, got %q", got, w.Header().Get("X-Request-ID"))
+			}
+			if (got == tt.header) != tt.keep {
+				t.Fatalf("expected the sent id to be kept: %v, got %q", tt.keep, got)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var gotErr error
+	m := &Manager{WriteError: func(w http.ResponseWriter, r *http.Request, err error) {
+		gotErr = err
+		w.WriteHeader(http.StatusInternalServerError)
+	}}
+
+	w := httptest.NewRecorder()
+	m.Recover(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError || services.ErrorCodeOf(gotErr) != services.CodeInternal {
+		t.Fatalf("expected an internal error, got %d and %v", w.Code, gotErr)
+	}
+
+	// Once the response has started, there's no changing it
+	gotErr = nil
+	w = httptest.NewRecorder()
+	m.Recover(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	})(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusAccepted || gotErr != nil {
+		t.Fatalf("expected the started response to be left alone, got %d and %v", w.Code, gotErr)
+	}
+
+	// Aborting a handler is left to net/http
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Fatalf("expected ErrAbortHandler to be panicked again, got %v", p)
+		}
+	}()
+	m.Recover(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestMetrics(t *testing.T) {
+	stats := &fakeStats{counts: make(map[string]int64), timings: make(map[string]bool)}
+	m := &Manager{StatsClient: stats, WriteError: func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}}
+
+	ok := m.Run("v1.events.find", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	panics := m.Run("v1.event.get", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	ok(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/events", nil))
+	ok(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/events", nil))
+	panics(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/event/1", nil))
+
+	// A panic is still measured, as the 500 it was turned into
+	wantCounts := map[string]int64{"http.v1_events_find.status.200": 2, "http.v1_event_get.status.500": 1}
+	for k, v := range wantCounts {
+		if stats.counts[k] != v {
+			t.Fatalf("expected %s to be %d, got counts %v", k, v, stats.counts)
+		}
+	}
+	if len(stats.counts) != len(wantCounts) || !stats.timings["http.v1_events_find.latency"] || !stats.timings["http.v1_event_get.latency"] {
+		t.Fatalf("unexpected stats %v and %v", stats.counts, stats.timings)
+	}
+}
@@ -0,0 +1,100 @@
+package httpv1
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// searchParamsFromQuery builds EventSearchParams out of the query string, using the
+// same names as the JSON body accepted by FindEvents
+func searchParamsFromQuery(q url.Values) (*services.EventSearchParams, error) {
+	p := &services.EventSearchParams{
+		Application: q.Get("application"),
+		Type:        q.Get("type"),
+		Message:     q.Get("message"),
+	}
+
+	var err error
+	if v := q.Get("partial_message"); v != "" {
+		if p.PartialMessage, err = strconv.ParseBool(v); err != nil {
+			return nil, invalidQuery("Invalid partial_message: %s", v)
+		}
+	}
+	if p.Start, err = parseQueryTime(q, "start"); err != nil {
+		return nil, err
+	}
+	if p.End, err = parseQueryTime(q, "end"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// pageParamsFromQuery reads the limit, order and cursor used to page through a search
+func pageParamsFromQuery(q url.Values) (*services.EventPageParams, error) {
+	pg := &services.EventPageParams{
+		Order:  q.Get("order"),
+		Cursor: q.Get("cursor"),
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, invalidQuery("Invalid limit: %s", v)
+		}
+		pg.Limit = limit
+	}
+	return pg, nil
+}
+
+// histogramParamsFromQuery reads the interval and grouping of a histogram
+func histogramParamsFromQuery(q url.Values) (*services.EventHistogramParams, error) {
+	hp := &services.EventHistogramParams{
+		Interval: q.Get("interval"),
+		GroupBy:  q.Get("group_by"),
+	}
+	if v := q.Get("groups"); v != "" {
+		groups, err := strconv.Atoi(v)
+		if err != nil || groups < 0 {
+			return nil, invalidQuery("Invalid groups: %s", v)
+		}
+		hp.Groups = groups
+	}
+	return hp, nil
+}
+
+// facetParamsFromQuery reads the prefix and limit of a facet
+func facetParamsFromQuery(q url.Values) (*services.FacetParams, error) {
+	fp := &services.FacetParams{Prefix: q.Get("prefix")}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, invalidQuery("Invalid limit: %s", v)
+		}
+		fp.Limit = limit
+	}
+	return fp, nil
+}
+
+// parseQueryTime accepts either an RFC3339 timestamp or unix seconds, matching
+// the created_at format events are sent in
+func parseQueryTime(q url.Values, key string) (time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, invalidQuery("Invalid %s: %s", key, v)
+	}
+	return t, nil
+}
+
+func invalidQuery(format string, args ...interface{}) error {
+	return services.NewError(services.CodeInvalidRequest, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,55 @@
+package httpv1
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+func TestHistogramParamsFromQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    *services.EventHistogramParams
+		wantErr bool
+	}{
+		{query: "", want: &services.EventHistogramParams{}},
+		{query: "interval=5m&group_by=type&groups=3", want: &services.EventHistogramParams{Interval: "5m", GroupBy: "type", Groups: 3}},
+		{query: "groups=-1", wantErr: true},
+		{query: "groups=many", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			got, err := histogramParamsFromQuery(q)
+			if (err != nil) != tt.wantErr || !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %+v and error %v, got %+v and %v", tt.want, tt.wantErr, got, err)
+			}
+			if tt.wantErr && services.ErrorCodeOf(err) != services.CodeInvalidRequest {
+				t.Fatalf("expected an invalid request, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFacetParamsFromQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    *services.FacetParams
+		wantErr bool
+	}{
+		{query: "", want: &services.FacetParams{}},
+		{query: "prefix=check&limit=20", want: &services.FacetParams{Prefix: "check", Limit: 20}},
+		{query: "limit=-5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			got, err := facetParamsFromQuery(q)
+			if (err != nil) != tt.wantErr || !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %+v and error %v, got %+v and %v", tt.want, tt.wantErr, got, err)
+			}
+		})
+	}
+}
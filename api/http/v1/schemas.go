@@ -0,0 +1,108 @@
+package httpv1
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"github.com/gorilla/mux"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schemaFiles holds the JSON Schemas for the request bodies the v1 api accepts
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schemaBaseURL is the base the embedded schemas are registered under, so that
+// they may refer to one another
+const schemaBaseURL = "mem://blunderbuss/v1/"
+
+var (
+	eventSchema        = mustCompileSchema("event.json")
+	searchParamsSchema = mustCompileSchema("event_search_params.json")
+	deleteParamsSchema = mustCompileSchema("event_delete_params.json")
+)
+
+func mustCompileSchema(name string) *jsonschema.Schema {
+	c := jsonschema.NewCompiler()
+	err := fs.WalkDir(schemaFiles, "schemas", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := schemaFiles.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return c.AddResource(schemaBaseURL+path, bytes.NewReader(b))
+	})
+	if err != nil {
+		panic(err)
+	}
+	return c.MustCompile(schemaBaseURL + "schemas/" + name)
+}
+
+// serveSchema serves the schema named by the {file} route variable. Schemas link
+// to v1's routes, which are pointed at h.Prefix's instead when it differs
+func (h *HTTPApi) serveSchema(w http.ResponseWriter, r *http.Request) {
+	b, err := fs.ReadFile(schemaFiles, "schemas/"+mux.Vars(r)["file"])
+	if err != nil {
+		writeError(w, r, services.NewError(services.CodeNotFound, "No such schema"))
+		return
+	}
+	if h.Prefix != "v1" {
+		b = bytes.ReplaceAll(b, []byte(`"href": "/v1/`), []byte(`"href": "/`+h.Prefix+`/`))
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// validateBody checks b against schema. Every failing field is reported in the
+// details of the returned error
+func validateBody(schema *jsonschema.Schema, b []byte) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return errBadRequest("Malformed JSON", err)
+	}
+
+	err := schema.Validate(v)
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err
+	}
+	fields := collectFieldErrors(ve, nil)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+	return &services.Error{
+		Code:    services.CodeValidationFailed,
+		Message: "Request body does not match its schema",
+		Details: fields,
+	}
+}
+
+// collectFieldErrors flattens a tree of validation errors down to its leaves,
+// which are the failures that actually describe a field
+func collectFieldErrors(ve *jsonschema.ValidationError, fields []services.FieldError) []services.FieldError {
+	if len(ve.Causes) == 0 {
+		path := ve.InstanceLocation
+		if path == "" {
+			path = "/"
+		}
+		return append(fields, services.FieldError{Path: path, Message: ve.Message})
+	}
+	for _, c := range ve.Causes {
+		fields = collectFieldErrors(c, fields)
+	}
+	return fields
+}
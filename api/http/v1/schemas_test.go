@@ -0,0 +1,72 @@
+package httpv1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+func TestValidateBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    *jsonschema.Schema
+		body      string
+		wantCode  services.ErrorCode
+		wantPaths []string
+	}{
+		{name: "valid event", schema: eventSchema, body: `{"application":"billing","type":"error","context":{"user":1},"created_at":1700000000}`},
+		{name: "null context", schema: eventSchema, body: `{"application":"billing","type":"error","context":null}`},
+		// Every failing field is listed, not just the first
+		{name: "several bad fields", schema: eventSchema, body: `{"application":7,"type":"error","context":"text","created_at":"yesterday"}`, wantCode: services.CodeValidationFailed, wantPaths: []string{"/application", "/context", "/created_at"}},
+		{name: "empty event_id", schema: eventSchema, body: `{"application":"billing","type":"error","event_id":""}`, wantCode: services.CodeValidationFailed, wantPaths: []string{"/event_id"}},
+		{name: "not an object", schema: eventSchema, body: `"an event"`, wantCode: services.CodeValidationFailed, wantPaths: []string{"/"}},
+		{name: "malformed", schema: eventSchema, body: `{"application":`, wantCode: services.CodeInvalidRequest},
+		{name: "valid search", schema: searchParamsSchema, body: `{"application":"billing","partial_message":true}`},
+		{name: "bad search", schema: searchParamsSchema, body: `{"application":"billing","partial_message":"yes"}`, wantCode: services.CodeValidationFailed, wantPaths: []string{"/partial_message"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBody(tt.schema, []byte(tt.body))
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if services.ErrorCodeOf(err) != tt.wantCode {
+				t.Fatalf("expected a %s error, got %v", tt.wantCode, err)
+			}
+			if tt.wantPaths == nil {
+				return
+			}
+			var paths []string
+			for _, f := range err.(*services.Error).Details.([]services.FieldError) {
+				paths = append(paths, f.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Fatalf("expected failures for %v, got %v", tt.wantPaths, paths)
+			}
+		})
+	}
+}
+
+func TestRecordEventValidatesSchema(t *testing.T) {
+	es := &fakeEventService{}
+	h, err := New(&Config{EventService: es})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.NewRouter().ServeHTTP(w, httptest.NewRequest("PUT", "/v1/event", strings.NewReader(`{"application":["billing"],"type":"error"}`)))
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"path":"/application"`) {
+		t.Fatalf("expected the failing field to be reported, got %d: %s", w.Code, w.Body)
+	}
+	if len(es.stored) != 0 {
+		t.Fatal("expected nothing to be stored")
+	}
+}
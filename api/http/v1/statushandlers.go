@@ -1,11 +1,47 @@
 package httpv1
 
 import (
-	"encoding/json"
 	"net/http"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
 )
 
+// readinessResponse is the body returned by the readiness check
+type readinessResponse struct {
+	*services.HealthReport
+	Version string `json:"version"`
+	Sha     string `json:"sha"`
+}
+
 func (h *HTTPApi) statusServer(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// liveness reports that the process is up and able to serve requests. It never
+// checks dependencies, so that an outage elsewhere doesn't get us restarted
+func (h *HTTPApi) liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status":  services.HealthOK,
+		"version": h.Config.AppVersion,
+		"sha":     h.Config.Sha,
+	})
+}
+
+// readiness reports whether we can do useful work, checking each dependency. It
+// responds with 503 if any of them are unavailable
+func (h *HTTPApi) readiness(w http.ResponseWriter, r *http.Request) {
+	resp := readinessResponse{
+		HealthReport: &services.HealthReport{Status: services.HealthOK},
+		Version:      h.Config.AppVersion,
+		Sha:          h.Config.Sha,
+	}
+	if h.Config.Health != nil {
+		resp.HealthReport = h.Config.Health.Check(r.Context())
+	}
+
+	status := http.StatusOK
+	if resp.Status != services.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
 }
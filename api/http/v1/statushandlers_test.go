@@ -0,0 +1,72 @@
+package httpv1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// fakeHealth reports every component with status
+type fakeHealth struct {
+	status string
+}
+
+func (f *fakeHealth) Check(ctx context.Context) *services.HealthReport {
+	return &services.HealthReport{
+		Status:     f.status,
+		Components: map[string]services.ComponentHealth{"database": {Status: f.status, LatencyMs: 1.5}},
+	}
+}
+
+func TestStatusChecks(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		health     string
+		wantStatus int
+	}{
+		{name: "ready", path: "/v1/status/ready", health: services.HealthOK, wantStatus: http.StatusOK},
+		{name: "not ready", path: "/v1/status/ready", health: services.HealthUnavailable, wantStatus: http.StatusServiceUnavailable},
+		// Liveness doesn't depend on anything else being up
+		{name: "live", path: "/v1/status/live", health: services.HealthUnavailable, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(&Config{AppVersion: "1.2.3", Sha: "abc123", Health: &fakeHealth{status: tt.health}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			h.NewRouter().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			var body struct {
+				Status     string                              `json:"status"`
+				Version    string                              `json:"version"`
+				Sha        string                              `json:"sha"`
+				Components map[string]services.ComponentHealth `json:"components"`
+			}
+			if err = json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Version != "1.2.3" || body.Sha != "abc123" {
+				t.Fatalf("expected the version and sha, got %s", w.Body)
+			}
+			if tt.path == "/v1/status/live" {
+				if body.Status != services.HealthOK || body.Components != nil {
+					t.Fatalf("expected liveness without components, got %s", w.Body)
+				}
+				return
+			}
+			if body.Status != tt.health || body.Components["database"].Status != tt.health || body.Components["database"].LatencyMs != 1.5 {
+				t.Fatalf("expected each component to be reported, got %s", w.Body)
+			}
+		})
+	}
+}
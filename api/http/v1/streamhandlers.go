@@ -0,0 +1,71 @@
+package httpv1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// streamHeartbeatInterval is how often a comment is sent on an idle stream, so that
+// proxies and clients don't time the connection out
+const streamHeartbeatInterval = 15 * time.Second
+
+// StreamEvents sends newly logged events matching the application, type and message
+// query parameters as Server-Sent Events, until the client goes away or falls too
+// far behind
+func (h *HTTPApi) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || h.Config.Broadcaster == nil {
+		writeError(w, r, services.NewError(services.CodeUnavailable, "Streaming is not supported"))
+		return
+	}
+
+	p, err := searchParamsFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err = scopeSearch(r, p); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	sub := h.Config.Broadcaster.Subscribe(p)
+	defer h.Config.Broadcaster.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case e, ok := <-sub.Events:
+			if !ok {
+				if sub.Dropped() {
+					fmt.Fprint(w, "event: dropped\ndata: {\"message\":\"Subscriber fell too far behind\"}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: event\ndata: %s\n\n", e.ID, b)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package httpv1
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// readSSE reads the next event from an event stream, skipping comments
+func readSSE(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended early: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(fields) > 0 {
+				return fields
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		fields[parts[0]] = parts[1]
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	ib, err := services.NewEventBroadcaster(&services.EventBroadcasterConfig{BufferSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ib.(*services.EventBroadcaster)
+	h, err := New(&Config{Broadcaster: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h.NewRouter())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/events/stream?application=billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(resp.Body)
+
+	// Only events matching the filter are sent
+	b.Publish(&models.Event{ID: "1", Application: "search", Type: "error", Context: []byte("{}")})
+	b.Publish(&models.Event{ID: "2", Application: "billing", Type: "error", Context: []byte("{}")})
+	got := readSSE(t, r)
+	var e models.Event
+	if err = json.Unmarshal([]byte(got["data"]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if got["event"] != "event" || got["id"] != "2" || e.ID != "2" {
+		t.Fatalf("expected event 2, got %v", got)
+	}
+
+	// A stream which isn't being read is dropped once its buffer overflows, which
+	// the handler may put off for a while by writing into the connection's buffers
+	big := &models.Event{ID: "3", Application: "billing", Type: "error", Message: strings.Repeat("x", 1<<16), Context: []byte("{}")}
+	for b.Stats().Subscribers > 0 {
+		b.Publish(big)
+	}
+	for {
+		got = readSSE(t, r)
+		if got["event"] == "dropped" {
+			break
+		}
+		if got["event"] != "event" {
+			t.Fatalf("unexpected event %v", got)
+		}
+	}
+	if _, err = r.ReadString('\n'); err == nil {
+		t.Fatal("expected the stream to end once dropped")
+	}
+}
+
+func TestStreamEventsWithoutBroadcaster(t *testing.T) {
+	h, err := New(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.NewRouter().ServeHTTP(w, httptest.NewRequest("GET", "/v1/events/stream", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
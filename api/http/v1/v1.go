@@ -1,13 +1,15 @@
 package httpv1
 
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"log"
+	"errors"
 	"net/http"
+	"strings"
 
 	//"github.com/facebookgo/grace/gracehttp"
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1/middleware"
+	"github.com/StabbyCutyou/blunderbuss/logging"
 	"github.com/StabbyCutyou/blunderbuss/models"
 	"github.com/StabbyCutyou/blunderbuss/services"
 	"github.com/gorilla/mux"
@@ -15,137 +17,538 @@ import (
 
 // HTTPApi represents the object used to govern http calls into the system
 type HTTPApi struct {
-	Config *Config
-	Router *mux.Router
-	Server *http.Server
+	Config     *Config
+	Middleware *middleware.Manager
+	// Prefix names the version the api is served as, "v1" unless a version built
+	// on this one changes it. Route metrics are labelled with it, and the links in
+	// served schemas point to routes under it
+	Prefix string
 }
 
 // Config is the configuration for the HTTPApi struct
 type Config struct {
-	Version int
-	Port    int
-	Sha     string
+	Sha string
+	// AppVersion is the version of blunderbuss itself, rather than of the api
+	AppVersion string
+	// MaxBodySize caps how large a request body may be, as sent
+	MaxBodySize int64
+	// MaxDecompressedBodySize caps how large a compressed request body may expand to
+	MaxDecompressedBodySize int64
 
-	EventService services.IEventLoggingService
+	EventService  services.IEventLoggingService
+	Broadcaster   services.IEventBroadcaster
+	StatsClient   services.StatsdClient
+	MetricService services.IMetricLoggingService
+	// Prometheus is optional, when set request metrics are recorded there as well
+	Prometheus *services.PrometheusMetrics
+	KeyService services.IAPIKeyService
+	Health     services.IHealthService
+	// RequireAPIKeys turns on enforcement of the Authorization header
+	RequireAPIKeys bool
+	// ClientCertApplications maps the CN or a SAN of a verified client certificate
+	// to the applications that client may access
+	ClientCertApplications map[string][]string
+	// RateLimiter is optional, when set ingest is rate limited
+	RateLimiter services.IRateLimitService
+	// IngestControl is optional, when set writes are refused while it is paused
+	IngestControl services.IIngestControl
 }
 
 // New initializes a new http api
 func New(config *Config) (*HTTPApi, error) {
 	h := &HTTPApi{
 		Config: config,
+		Prefix: "v1",
 	}
 
-	http.Handle("/", h.NewRouter())
+	m, err := middleware.NewManager(&middleware.ManagerConfig{
+		StatsClient:    config.StatsClient,
+		KeyService:     config.KeyService,
+		RequireAPIKeys: config.RequireAPIKeys,
+		WriteError:     writeError,
 
-	server := &http.Server{Handler: http.DefaultServeMux}
-	h.Server = server
+		ClientCertApplications: config.ClientCertApplications,
+		RateLimiter:            config.RateLimiter,
+		Prometheus:             config.Prometheus,
+		IngestControl:          config.IngestControl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.Middleware = m
 	return h, nil
 }
 
-// NewRouter builds the router for the server. We export this method for testing
+// Version is the version of the api this package serves
+func (h *HTTPApi) Version() int {
+	return 1
+}
+
+// NewRouter builds a router serving only this version of the api. We export this
+// method for testing, the server builds its own router with RegisterRoutes
 func (h *HTTPApi) NewRouter() http.Handler {
 	// Create a gorilla mux
 	router := mux.NewRouter()
 	// Strict Slash is documented here: http://www.gorillatoolkit.org/pkg/mux#Router.StrictSlash
 	// It means we will try to match /path and /path/
 	router.StrictSlash(true)
+	router.NotFoundHandler = h.NotFoundHandler()
+	h.RegisterRoutes(router.PathPrefix("/v1").Subrouter())
+	return router
+}
+
+// NotFoundHandler reports unknown routes using the api's error envelope
+func (h *HTTPApi) NotFoundHandler() http.Handler {
+	return http.HandlerFunc(h.Middleware.Run(h.Prefix+".not_found", notFound))
+}
 
-	v1Router := router.PathPrefix("/v1").Subrouter()
+// RegisterRoutes adds every route of the api to v1Router, which is expected to
+// already be scoped to the version's path prefix
+func (h *HTTPApi) RegisterRoutes(v1Router *mux.Router) {
+	m := h.Middleware
+	// Label each route with the version, so that traffic to each can be told apart
+	run := func(route string, rh middleware.RequestHandler, stack ...middleware.Middleware) middleware.RequestHandler {
+		return m.Run(h.Prefix+"."+route, rh, stack...)
+	}
 	statusRoutes := v1Router.PathPrefix("/status").Subrouter()
 	// Define our health check under a modern route (status)
-	statusRoutes.HandleFunc("/", h.statusServer).Methods("GET", "HEAD")
+	statusRoutes.HandleFunc("/", run("status", h.statusServer)).Methods("GET", "HEAD")
+	statusRoutes.HandleFunc("/live", run("status.live", h.liveness)).Methods("GET", "HEAD")
+	statusRoutes.HandleFunc("/ready", run("status.ready", h.readiness)).Methods("GET", "HEAD")
 
-	v1Router.HandleFunc("/event", h.RecordEvent).Methods("PUT")
-	v1Router.HandleFunc("/events", h.FindEvents).Methods("POST")
+	v1Router.HandleFunc("/event", run("event.record", h.RecordEvent, m.Ingest)).Methods("PUT")
+	v1Router.HandleFunc("/event/{id}", run("event.get", h.GetEvent, m.Read)).Methods("GET")
+	v1Router.HandleFunc("/events/batch", run("events.batch", h.RecordEvents, m.Ingest)).Methods("PUT")
+	v1Router.HandleFunc("/events", run("events.find", h.FindEvents, m.Read)).Methods("POST")
+	v1Router.HandleFunc("/events", run("events.search", h.SearchEvents, m.Read)).Methods("GET")
+	v1Router.HandleFunc("/events/stream", run("events.stream", h.StreamEvents, m.Read)).Methods("GET")
+	v1Router.HandleFunc("/events/histogram", run("events.histogram", h.EventHistogram, m.Read)).Methods("GET")
+	v1Router.HandleFunc("/events/export", run("events.export", h.ExportEvents, m.Read)).Methods("GET")
+	v1Router.HandleFunc("/facets/applications", run("facets.applications", h.facetHandler(services.FacetApplication), m.Read)).Methods("GET")
+	v1Router.HandleFunc("/facets/types", run("facets.types", h.facetHandler(services.FacetType), m.Read)).Methods("GET")
+	v1Router.HandleFunc("/facets/messages", run("facets.messages", h.facetHandler(services.FacetMessage), m.Read)).Methods("GET")
+	v1Router.HandleFunc("/events/delete", run("events.delete", h.DeleteEvents, m.Admin)).Methods("POST")
+	v1Router.HandleFunc("/browser/events", run("browser.events", h.RecordBrowserEvents, m.Browser)).Methods("POST", "OPTIONS")
 
-	// Serve our JSON Hyper Schemas as files directly
-	// if we don't strip the prefix here, it will look for /api/http/v1/schemas/v1/schemas/{path}
-	//s := http.StripPrefix("/v1/schemas/", http.FileServer(http.Dir("./api/http/v1/schemas/")))
-	//v1Router.PathPrefix("/schemas").Handler(SchemaLogger(s))
-
-	return router
+	// Serve our JSON Hyper Schemas directly out of the binary
+	v1Router.HandleFunc("/schemas/{file}", run("schemas", h.serveSchema)).Methods("GET", "HEAD")
 }
 
-// Listen is
-func (h *HTTPApi) Listen() error {
-	h.Server.Addr = fmt.Sprintf("0.0.0.0:%d", h.Config.Port)
-
-	log.Printf("Blunderbuss listening on %s\n", h.Server.Addr)
-	log.Fatal(h.Server.ListenAndServe())
-
-	return nil
-}
+const (
+	// idempotencyKeyHeader lets clients retry RecordEvent without the event being
+	// stored twice
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader is set on responses to retries of an earlier request
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
 
 // RecordEvent is
 func (h *HTTPApi) RecordEvent(w http.ResponseWriter, r *http.Request) {
 	var e models.Event
-	b, err := ioutil.ReadAll(r.Body)
+	if err := h.Middleware.LimitRequest(r, 1); err != nil {
+		h.recordRejected("", err, 1)
+		writeError(w, r, err)
+		return
+	}
+	b, err := h.readBody(r)
 	if err != nil {
-		w.WriteHeader(500)
-		resp, _ := json.Marshal(map[string]string{"error": err.Error(), "a": "a"})
-		w.Write(resp)
+		writeError(w, r, err)
 		return
 	}
 
-	if err = r.Body.Close(); err != nil {
-		w.WriteHeader(500)
-		resp, _ := json.Marshal(map[string]string{"error": err.Error(), "b": "b"})
-		w.Write(resp)
+	if err = validateBody(eventSchema, b); err != nil {
+		h.recordRejected("", err, 1)
+		writeError(w, r, err)
 		return
 	}
-
 	if err = json.Unmarshal(b, &e); err != nil {
-		w.WriteHeader(500)
-		resp, _ := json.Marshal(map[string]string{"error": err.Error(), "c": "c"})
-		w.Write(resp)
+		err = errBadRequest("Malformed event", err)
+		h.recordRejected("", err, 1)
+		writeError(w, r, err)
+		return
+	}
+	// The header is for retries of the whole request, so it wins over event_id
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		e.IdempotencyKey = key
+	}
+
+	if err = authorizeApplication(r, e.Application); err != nil {
+		h.recordRejected("", err, 1)
+		writeError(w, r, err)
+		return
+	}
+	if err = h.limitApplication(e.Application); err != nil {
+		h.recordRejected(e.Application, err, 1)
+		writeError(w, r, err)
 		return
 	}
 
 	if err = h.Config.EventService.LogEvent(&e); err != nil {
-		w.WriteHeader(500)
-		resp, _ := json.Marshal(map[string]string{"error": err.Error(), "d": "d"})
-		w.Write(resp)
+		h.recordRejected(e.Application, err, 1)
+		writeError(w, r, err)
+		return
+	}
+	// A replay gets the same response as the original request did
+	if e.Replayed {
+		w.Header().Set(idempotentReplayedHeader, "true")
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "id": e.ID})
+}
+
+// GetEvent returns the event with the id in the path. Events belonging to
+// applications the API key may not read are reported as not found
+func (h *HTTPApi) GetEvent(w http.ResponseWriter, r *http.Request) {
+	e, err := h.Config.EventService.GetEvent(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Don't reveal that events outside of the key's applications exist
+	if authorizeApplication(r, e.Application) != nil {
+		writeError(w, r, services.ErrEventNotFound)
 		return
 	}
-	w.WriteHeader(200)
-	resp, _ := json.Marshal(map[string]string{"status": "ok"})
-	w.Write(resp)
-	return
+	writeJSON(w, http.StatusOK, e)
+}
+
+// batchItemResult is the outcome of a single event submitted to RecordEvents
+type batchItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	// Replayed is true when the event's event_id had already been logged. ID is
+	// then that of the event logged the first time
+	Replayed bool        `json:"replayed,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+const (
+	batchItemAccepted = "accepted"
+	batchItemRejected = "rejected"
+)
+
+// RecordEvents accepts many events in a single request, either as a JSON array or
+// as newline delimited JSON. Events which fail to parse are rejected individually,
+// the remainder are written together
+func (h *HTTPApi) RecordEvents(w http.ResponseWriter, r *http.Request) {
+	b, err := h.readBody(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	items, err := splitBatch(b, r.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(w, r, errBadRequest("Malformed batch", err))
+		return
+	}
+	if err = h.Middleware.LimitRequest(r, len(items)); err != nil {
+		h.recordRejected("", err, len(items))
+		writeError(w, r, err)
+		return
+	}
+
+	results, err := h.logBatch(r, items, nil)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "results": results})
+}
+
+// logBatch parses and logs each item of a batch. Items that fail to parse, or that
+// the request's API key may not write, are rejected individually. If prepare is
+// not nil it is called on each parsed event before it is authorized
+func (h *HTTPApi) logBatch(r *http.Request, items []json.RawMessage, prepare func(*models.Event)) ([]batchItemResult, error) {
+	results := make([]batchItemResult, len(items))
+	evts := make([]*models.Event, 0, len(items))
+	accepted := make([]int, 0, len(items))
+	for i, item := range items {
+		results[i].Index = i
+		if err := validateBody(eventSchema, item); err != nil {
+			h.recordRejected("", err, 1)
+			results[i].Status = batchItemRejected
+			results[i].Error = err.Error()
+			var se *services.Error
+			if errors.As(err, &se) {
+				results[i].Details = se.Details
+			}
+			continue
+		}
+		e := &models.Event{}
+		if err := json.Unmarshal(item, e); err != nil {
+			h.recordRejected("", errBadRequest("Malformed event", err), 1)
+			results[i].Status = batchItemRejected
+			results[i].Error = err.Error()
+			continue
+		}
+		if prepare != nil {
+			prepare(e)
+		}
+		if err := authorizeApplication(r, e.Application); err != nil {
+			h.recordRejected("", err, 1)
+			results[i].Status = batchItemRejected
+			results[i].Error = err.Error()
+			continue
+		}
+		if err := h.limitApplication(e.Application); err != nil {
+			h.recordRejected(e.Application, err, 1)
+			results[i].Status = batchItemRejected
+			results[i].Error = err.Error()
+			var se *services.Error
+			if errors.As(err, &se) {
+				results[i].Details = se.Details
+			}
+			continue
+		}
+		if err := h.Config.EventService.PrepareEvent(e); err != nil {
+			h.recordRejected(e.Application, err, 1)
+			results[i].Status = batchItemRejected
+			results[i].Error = err.Error()
+			var se *services.Error
+			if errors.As(err, &se) {
+				results[i].Details = se.Details
+			}
+			continue
+		}
+		results[i].Status = batchItemAccepted
+		evts = append(evts, e)
+		accepted = append(accepted, i)
+	}
+
+	if err := h.Config.EventService.LogEvents(evts); err != nil {
+		for _, e := range evts {
+			h.recordRejected(e.Application, err, 1)
+		}
+		return nil, err
+	}
+	for j, i := range accepted {
+		results[i].ID = evts[j].ID
+		results[i].Replayed = evts[j].Replayed
+	}
+	return results, nil
+}
+
+// recordRejected counts n events refused with err. app should be empty unless the
+// request has been authorized to write to it
+func (h *HTTPApi) recordRejected(app string, err error, n int) {
+	if h.Config.MetricService != nil {
+		h.Config.MetricService.RecordRejected(app, string(services.ErrorCodeOf(err)), n)
+	}
+}
+
+// limitApplication takes a token from the application's rate limit
+func (h *HTTPApi) limitApplication(app string) error {
+	if h.Config.RateLimiter == nil {
+		return nil
+	}
+	if ok, wait := h.Config.RateLimiter.Allow(services.RateLimitApplication, app, 1); !ok {
+		return services.NewRateLimitedError(services.RateLimitApplication, wait)
+	}
+	return nil
 }
 
-// FindEvents is
+// splitBatch breaks a batch body into the raw JSON for each event. A body is treated
+// as a JSON array if it starts with [, otherwise it is read as newline delimited JSON
+func splitBatch(b []byte, contentType string) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(b)
+	if !strings.HasPrefix(contentType, "application/x-ndjson") && len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	items := make([]json.RawMessage, 0)
+	for _, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		items = append(items, json.RawMessage(line))
+	}
+	return items, nil
+}
+
+// nextCursorHeader carries the cursor for the next page of a FindEvents search,
+// whose body is a bare list of events with nowhere else to put it
+const nextCursorHeader = "X-Next-Cursor"
+
+// FindEvents searches for the events matching the JSON body. Like SearchEvents it
+// returns a single page, which the limit, order and cursor query parameters choose.
+// The cursor for the next page is sent in the X-Next-Cursor header
 func (h *HTTPApi) FindEvents(w http.ResponseWriter, r *http.Request) {
 	var e services.EventSearchParams
-	b, err := ioutil.ReadAll(r.Body)
+	b, err := h.readBody(r)
 	if err != nil {
-		w.WriteHeader(500)
-		resp, _ := json.Marshal(map[string]string{"error": err.Error(), "a": "a"})
-		w.Write(resp)
+		writeError(w, r, err)
 		return
 	}
 
-	if err = r.Body.Close(); err != nil {
-		w.WriteHeader(500)
-		resp, _ := json.Marshal(map[string]string{"error": err.Error(), "b": "b"})
-		w.Write(resp)
+	if err = validateBody(searchParamsSchema, b); err != nil {
+		writeError(w, r, err)
 		return
 	}
-
 	if err = json.Unmarshal(b, &e); err != nil {
-		w.WriteHeader(500)
-		resp, _ := json.Marshal(map[string]string{"error": err.Error(), "c": "c"})
-		w.Write(resp)
+		writeError(w, r, errBadRequest("Malformed search", err))
 		return
 	}
 
-	evts, err := h.Config.EventService.FindEvents(&e)
+	pg, err := pageParamsFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err = scopeSearch(r, &e); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	page, err := h.Config.EventService.FindEventsPage(&e, pg)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if page.NextCursor != "" {
+		w.Header().Set(nextCursorHeader, page.NextCursor)
+	}
+	writeCompressedJSON(w, r, http.StatusOK, page.Events)
+}
+
+// SearchEvents is the query string equivalent of FindEvents, which returns a single
+// page of results along with the cursor for the next page
+func (h *HTTPApi) SearchEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, err := searchParamsFromQuery(q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	pg, err := pageParamsFromQuery(q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err = scopeSearch(r, p); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	page, err := h.Config.EventService.FindEventsPage(p, pg)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeCompressedJSON(w, r, http.StatusOK, page)
+}
+
+// EventHistogram counts the events matching the search in the query string over
+// time, in buckets of the interval asked for. Buckets without events are included
+// with a count of 0
+func (h *HTTPApi) EventHistogram(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, err := searchParamsFromQuery(q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hp, err := histogramParamsFromQuery(q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err = scopeSearch(r, p); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	hist, err := h.Config.EventService.EventHistogram(p, hp)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeCompressedJSON(w, r, http.StatusOK, hist)
+}
+
+// facetHandler lists the values of facet, with their counts and when they were
+// first and last seen. The values may be narrowed with the same query string as
+// SearchEvents, for example to the types within one application, and by prefix
+// for autocompletion
+func (h *HTTPApi) facetHandler(facet string) middleware.RequestHandler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		p, err := searchParamsFromQuery(q)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		fp, err := facetParamsFromQuery(q)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err = scopeSearch(r, p); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		values, err := h.Config.EventService.EventFacets(facet, p, fp)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeCompressedJSON(w, r, http.StatusOK, map[string]interface{}{"facet": facet, "values": values})
+	}
+}
+
+// DeleteEvents removes every event matching the filters in the body, which are the
+// same as for FindEvents. With dry_run set it only reports how many would go
+func (h *HTTPApi) DeleteEvents(w http.ResponseWriter, r *http.Request) {
+	var p services.EventDeleteParams
+	b, err := h.readBody(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err = validateBody(deleteParamsSchema, b); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err = json.Unmarshal(b, &p); err != nil {
+		writeError(w, r, errBadRequest("Malformed delete", err))
+		return
+	}
+
+	if err = scopeSearch(r, &p.EventSearchParams); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	deleted, err := h.Config.EventService.DeleteEvents(&p)
+	if !p.DryRun && deleted > 0 {
+		keyID := ""
+		if k := middleware.APIKeyFromRequest(r); k != nil {
+			keyID = k.ID
+		}
+		logging.Infof("deleted %d events key=%s request_id=%s application=%q type=%q message=%q start=%s end=%s",
+			deleted, keyID, requestID(w, r), p.Application, p.Type, p.Message, p.Start, p.End)
+	}
 	if err != nil {
-		w.WriteHeader(500)
-		resp, _ := json.Marshal(map[string]string{"error": err.Error(), "d": "d"})
-		w.Write(resp)
+		if deleted > 0 {
+			// Report what was done, so the caller knows to retry for the remainder
+			err = &services.Error{
+				Code:    services.ErrorCodeOf(err),
+				Message: "Delete stopped part way",
+				Details: map[string]int64{"deleted": deleted},
+				Err:     err,
+			}
+		}
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(200)
-	resp, _ := json.Marshal(evts)
-	w.Write(resp)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "deleted": deleted, "dry_run": p.DryRun})
 }
@@ -0,0 +1,504 @@
+package httpv1
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+)
+
+// fakeEventService stores events in memory, and answers searches with page.
+// Events without a type fail to prepare
+type fakeEventService struct {
+	services.IEventLoggingService
+	mu     sync.Mutex
+	stored []*models.Event
+	logErr error
+	// keys maps application/idempotency key to the id of the event stored with it
+	keys map[string]string
+
+	page    *services.EventPage
+	pageErr error
+	pg      *services.EventPageParams
+
+	// exportErr is returned by ExportEvents after every stored event is exported
+	exportErr   error
+	contextKeys []string
+
+	deleted   int64
+	deleteErr error
+	dp        *services.EventDeleteParams
+
+	facet       string
+	facetSearch *services.EventSearchParams
+}
+
+func (f *fakeEventService) PrepareEvent(e *models.Event) error {
+	if e.Type == "" {
+		return &services.Error{Code: services.CodeValidationFailed, Message: "Event is missing required fields", Details: []services.FieldError{{Path: "/type", Message: "is required"}}}
+	}
+	return nil
+}
+
+func (f *fakeEventService) LogEvent(e *models.Event) error {
+	if err := f.PrepareEvent(e); err != nil {
+		return err
+	}
+	return f.LogEvents([]*models.Event{e})
+}
+
+func (f *fakeEventService) LogEvents(es []*models.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.logErr != nil {
+		return f.logErr
+	}
+	for _, e := range es {
+		if e.IdempotencyKey != "" {
+			if id, ok := f.keys[e.Application+"/"+e.IdempotencyKey]; ok {
+				e.ID, e.Replayed = id, true
+				continue
+			}
+		}
+		e.ID = fmt.Sprintf("00000000-0000-4000-8000-%012d", len(f.stored)+1)
+		f.stored = append(f.stored, e)
+		if e.IdempotencyKey != "" {
+			if f.keys == nil {
+				f.keys = make(map[string]string)
+			}
+			f.keys[e.Application+"/"+e.IdempotencyKey] = e.ID
+		}
+	}
+	return nil
+}
+
+func (f *fakeEventService) GetEvent(id string) (*models.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.stored {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, services.ErrEventNotFound
+}
+
+func (f *fakeEventService) ExportEvents(ctx context.Context, p *services.EventSearchParams, order string, each func(*models.Event) error) error {
+	for _, e := range f.stored {
+		if err := each(e); err != nil {
+			return err
+		}
+	}
+	return f.exportErr
+}
+
+func (f *fakeEventService) ContextKeys(ctx context.Context, p *services.EventSearchParams) ([]string, error) {
+	return f.contextKeys, nil
+}
+
+func (f *fakeEventService) DeleteEvents(p *services.EventDeleteParams) (int64, error) {
+	f.dp = p
+	return f.deleted, f.deleteErr
+}
+
+func (f *fakeEventService) EventFacets(facet string, p *services.EventSearchParams, fp *services.FacetParams) ([]services.FacetValue, error) {
+	f.facet, f.facetSearch = facet, p
+	return []services.FacetValue{{Value: "billing", Count: 3}}, nil
+}
+
+func (f *fakeEventService) FindEventsPage(p *services.EventSearchParams, pg *services.EventPageParams) (*services.EventPage, error) {
+	f.pg = pg
+	return f.page, f.pageErr
+}
+
+func TestSplitBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        []string
+		wantErr     bool
+	}{
+		{name: "json array", body: `[{"type":"a"}, {"type":"b"}]`, contentType: "application/json", want: []string{`{"type":"a"}`, `{"type":"b"}`}},
+		{name: "empty json array", body: ` [] `, want: []string{}},
+		{name: "ndjson", body: "{\"type\":\"a\"}\n\n  {\"type\":\"b\"}  \n", contentType: "application/x-ndjson", want: []string{`{"type":"a"}`, `{"type":"b"}`}},
+		{name: "ndjson without a content type", body: "{\"type\":\"a\"}\n{\"type\":\"b\"}", want: []string{`{"type":"a"}`, `{"type":"b"}`}},
+		// Declared ndjson is never read as an array, even if a line is one
+		{name: "ndjson line holding an array", body: `[{"type":"a"}]`, contentType: "application/x-ndjson", want: []string{`[{"type":"a"}]`}},
+		{name: "malformed json array", body: `[{"type":"a"}`, wantErr: true},
+		{name: "empty body", body: "", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := splitBatch([]byte(tt.body), tt.contentType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make([]string, len(items))
+			for i, item := range items {
+				got[i] = string(item)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRecordEvents(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		contentType  string
+		logErr       error
+		wantStatus   int
+		wantStatuses []string
+		wantStored   int
+	}{
+		{
+			name:         "every event accepted",
+			body:         `[{"application":"billing","type":"error"},{"application":"billing","type":"deploy"}]`,
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{batchItemAccepted, batchItemAccepted},
+			wantStored:   2,
+		},
+		{
+			name:         "bad events rejected individually",
+			body:         `[{"application":"billing","type":"error"},{"application":"billing"},"not an event",{"application":"billing","type":7}]`,
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{batchItemAccepted, batchItemRejected, batchItemRejected, batchItemRejected},
+			wantStored:   1,
+		},
+		{
+			name:         "ndjson",
+			body:         "{\"application\":\"billing\",\"type\":\"error\"}\n{\"application\":\"billing\"}\n",
+			contentType:  "application/x-ndjson",
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{batchItemAccepted, batchItemRejected},
+			wantStored:   1,
+		},
+		{
+			name:       "malformed batch",
+			body:       `[{"application":"billing"`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "storing fails",
+			body:       `[{"application":"billing","type":"error"}]`,
+			logErr:     services.NewError(services.CodeUnavailable, "Database unavailable"),
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &fakeEventService{logErr: tt.logErr}
+			h, err := New(&Config{EventService: es})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("PUT", "/v1/events/batch", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			h.NewRouter().ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Results []batchItemResult `json:"results"`
+			}
+			if err = json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			statuses := make([]string, len(resp.Results))
+			for i, res := range resp.Results {
+				statuses[i] = res.Status
+				if res.Index != i {
+					t.Fatalf("result %d has index %d", i, res.Index)
+				}
+				if (res.Status == batchItemAccepted) != (res.ID != "") || (res.Status == batchItemRejected) != (res.Error != "") {
+					t.Fatalf("result %d is inconsistent: %+v", i, res)
+				}
+			}
+			if !reflect.DeepEqual(statuses, tt.wantStatuses) || len(es.stored) != tt.wantStored {
+				t.Fatalf("expected %v with %d stored, got %v with %d", tt.wantStatuses, tt.wantStored, statuses, len(es.stored))
+			}
+		})
+	}
+}
+
+func TestGetEvent(t *testing.T) {
+	const id = "00000000-0000-4000-8000-000000000001"
+	es := &fakeEventService{stored: []*models.Event{{ID: id, Application: "billing", Type: "error", Context: []byte("{}")}}}
+	h, err := New(&Config{EventService: es, ClientCertApplications: map[string][]string{"billing-client": {"billing"}, "search-client": {"search"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		client     string
+		wantStatus int
+	}{
+		{name: "found", id: id, client: "billing-client", wantStatus: http.StatusOK},
+		{name: "missing", id: "00000000-0000-4000-8000-000000000002", client: "billing-client", wantStatus: http.StatusNotFound},
+		// An event the caller may not read is reported as missing, not forbidden
+		{name: "another application's event", id: id, client: "search-client", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/event/"+tt.id, nil)
+			leaf := &x509.Certificate{Subject: pkix.Name{CommonName: tt.client}}
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+			w := httptest.NewRecorder()
+			h.NewRouter().ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var e models.Event
+			if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.ID != id {
+				t.Fatalf("expected event %s, got %s: %v", id, w.Body, err)
+			}
+		})
+	}
+}
+
+func TestFindEvents(t *testing.T) {
+	evts := []models.Event{
+		{ID: "00000000-0000-4000-8000-000000000002", Application: "billing", Type: "error", Context: []byte("{}")},
+		{ID: "00000000-0000-4000-8000-000000000001", Application: "billing", Type: "error", Context: []byte("{}")},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		body           string
+		page           *services.EventPage
+		err            error
+		wantPage       *services.EventPageParams
+		wantStatus     int
+		wantIDs        []string
+		wantNextCursor string
+	}{
+		{
+			name:       "default page",
+			body:       `{"application": "billing"}`,
+			page:       &services.EventPage{Events: evts, NextCursor: "next"},
+			wantPage:   &services.EventPageParams{},
+			wantStatus: http.StatusOK, wantIDs: []string{evts[0].ID, evts[1].ID}, wantNextCursor: "next",
+		},
+		{
+			name:       "following page",
+			query:      "?limit=2&order=asc&cursor=next",
+			body:       `{"application": "billing"}`,
+			page:       &services.EventPage{Events: evts[1:]},
+			wantPage:   &services.EventPageParams{Limit: 2, Order: "asc", Cursor: "next"},
+			wantStatus: http.StatusOK, wantIDs: []string{evts[1].ID},
+		},
+		{
+			name:       "invalid limit",
+			query:      "?limit=-1",
+			body:       `{"application": "billing"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid cursor",
+			query:      "?cursor=bogus",
+			body:       `{"application": "billing"}`,
+			err:        services.ErrInvalidCursor,
+			wantPage:   &services.EventPageParams{Cursor: "bogus"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &fakeEventService{page: tt.page, pageErr: tt.err}
+			h, err := New(&Config{EventService: es})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			h.FindEvents(w, httptest.NewRequest("POST", "/v1/events"+tt.query, strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if !reflect.DeepEqual(es.pg, tt.wantPage) {
+				t.Fatalf("expected page %+v, got %+v", tt.wantPage, es.pg)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got []models.Event
+			if err = json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]string, 0, len(got))
+			for _, e := range got {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || w.Header().Get(nextCursorHeader) != tt.wantNextCursor {
+				t.Fatalf("expected events %v and cursor %q, got %v and %q", tt.wantIDs, tt.wantNextCursor, ids, w.Header().Get(nextCursorHeader))
+			}
+		})
+	}
+}
+
+func TestDeleteEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		deleted     int64
+		err         error
+		wantStatus  int
+		wantParams  *services.EventDeleteParams
+		wantDeleted string
+	}{
+		{
+			name: "delete", body: `{"application":"billing","type":"debug"}`, deleted: 12,
+			wantStatus: http.StatusOK, wantParams: &services.EventDeleteParams{EventSearchParams: services.EventSearchParams{Application: "billing", Type: "debug"}},
+			wantDeleted: `"deleted":12`,
+		},
+		{
+			name: "dry run", body: `{"application":"billing","dry_run":true}`, deleted: 40,
+			wantStatus: http.StatusOK, wantParams: &services.EventDeleteParams{EventSearchParams: services.EventSearchParams{Application: "billing"}, DryRun: true},
+			wantDeleted: `"deleted":40`,
+		},
+		{name: "invalid body", body: `{"application":"billing","dry_run":"yes"}`, wantStatus: http.StatusUnprocessableEntity},
+		// The caller is told how much was deleted before the failure, so they can retry
+		{
+			name: "stopped part way", body: `{"application":"billing"}`, deleted: 5000, err: services.WrapError(services.CodeUnavailable, "Database unavailable", errors.New("connection reset")),
+			wantStatus: http.StatusServiceUnavailable, wantParams: &services.EventDeleteParams{EventSearchParams: services.EventSearchParams{Application: "billing"}},
+			wantDeleted: `"details":{"deleted":5000}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &fakeEventService{deleted: tt.deleted, deleteErr: tt.err}
+			h, err := New(&Config{EventService: es})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			h.NewRouter().ServeHTTP(w, httptest.NewRequest("POST", "/v1/events/delete", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantDeleted) {
+				t.Fatalf("expected status %d with %s, got %d: %s", tt.wantStatus, tt.wantDeleted, w.Code, w.Body)
+			}
+			if !reflect.DeepEqual(es.dp, tt.wantParams) {
+				t.Fatalf("expected params %+v, got %+v", tt.wantParams, es.dp)
+			}
+		})
+	}
+}
+
+func TestFacets(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		client     string
+		wantFacet  string
+		wantSearch *services.EventSearchParams
+	}{
+		{name: "applications", path: "/v1/facets/applications", wantFacet: services.FacetApplication, wantSearch: &services.EventSearchParams{}},
+		{name: "types within an application", path: "/v1/facets/types?application=billing", wantFacet: services.FacetType, wantSearch: &services.EventSearchParams{Application: "billing"}},
+		// Callers only discover the values of the applications they may read
+		{name: "scoped to the caller", path: "/v1/facets/messages", client: "billing-client", wantFacet: services.FacetMessage, wantSearch: &services.EventSearchParams{Applications: []string{"billing"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &fakeEventService{}
+			cfg := &Config{EventService: es}
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.client != "" {
+				cfg.ClientCertApplications = map[string][]string{tt.client: {"billing"}}
+				leaf := &x509.Certificate{Subject: pkix.Name{CommonName: tt.client}}
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+			}
+			h, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			h.NewRouter().ServeHTTP(w, r)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"value":"billing"`) {
+				t.Fatalf("expected the facet's values, got %d: %s", w.Code, w.Body)
+			}
+			if es.facet != tt.wantFacet || !reflect.DeepEqual(es.facetSearch, tt.wantSearch) {
+				t.Fatalf("expected facet %s of %+v, got %s of %+v", tt.wantFacet, tt.wantSearch, es.facet, es.facetSearch)
+			}
+		})
+	}
+}
+
+func TestRecordEventIdempotency(t *testing.T) {
+	es := &fakeEventService{}
+	h, err := New(&Config{EventService: es})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := h.NewRouter()
+	record := func(body, key string) (id string, replayed bool) {
+		r := httptest.NewRequest("PUT", "/v1/event", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(idempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		var resp map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp["id"], w.Header().Get(idempotentReplayedHeader) == "true"
+	}
+
+	first, replayed := record(`{"application":"billing","type":"error"}`, "retry-1")
+	if replayed {
+		t.Fatal("expected the first request not to be a replay")
+	}
+	// A retry is answered with the original id, and isn't stored again
+	if id, replayed := record(`{"application":"billing","type":"error"}`, "retry-1"); id != first || !replayed {
+		t.Fatalf("expected a replay of %s, got %s, replayed %v", first, id, replayed)
+	}
+	// The header takes precedence over the event's own event_id
+	if id, replayed := record(`{"application":"billing","type":"error","event_id":"retry-2"}`, "retry-1"); id != first || !replayed {
+		t.Fatalf("expected the header to win, got %s, replayed %v", id, replayed)
+	}
+	second, replayed := record(`{"application":"billing","type":"error","event_id":"retry-2"}`, "")
+	if second == first || replayed {
+		t.Fatalf("expected a new event, got %s, replayed %v", second, replayed)
+	}
+	if id, replayed := record(`{"application":"billing","type":"error","event_id":"retry-2"}`, ""); id != second || !replayed {
+		t.Fatalf("expected a replay of %s, got %s, replayed %v", second, id, replayed)
+	}
+	if len(es.stored) != 2 {
+		t.Fatalf("expected 2 events stored, got %d", len(es.stored))
+	}
+}
@@ -0,0 +1,54 @@
+// Package httpv2 is the second version of the http api. It starts out serving the
+// same endpoints as v1, and is where changes that would break v1 clients belong.
+// Routes that change should be registered here in place of v1's, rather than
+// altering v1 itself
+package httpv2
+
+import (
+	"net/http"
+
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1"
+	"github.com/gorilla/mux"
+)
+
+// HTTPApi represents the object used to govern http calls into the system
+type HTTPApi struct {
+	Config *Config
+	v1     *httpv1.HTTPApi
+}
+
+// Config is the configuration for the HTTPApi struct. v2 shares its dependencies
+// with v1, as the handlers it has not replaced are v1's
+type Config = httpv1.Config
+
+// New initializes a new http api
+func New(config *Config) (*HTTPApi, error) {
+	v1, err := httpv1.New(config)
+	if err != nil {
+		return nil, err
+	}
+	// Serve v1's schemas linking to v2's routes, and label v2's metrics as its own.
+	// Request bodies are still checked against v1's schemas, until v2 accepts
+	// something v1 doesn't
+	v1.Prefix = "v2"
+	return &HTTPApi{
+		Config: config,
+		v1:     v1,
+	}, nil
+}
+
+// Version is the version of the api this package serves
+func (h *HTTPApi) Version() int {
+	return 2
+}
+
+// RegisterRoutes adds every route of the api to v2Router, which is expected to
+// already be scoped to the version's path prefix
+func (h *HTTPApi) RegisterRoutes(v2Router *mux.Router) {
+	h.v1.RegisterRoutes(v2Router)
+}
+
+// NotFoundHandler reports unknown routes using the api's error envelope
+func (h *HTTPApi) NotFoundHandler() http.Handler {
+	return h.v1.NotFoundHandler()
+}
@@ -0,0 +1,106 @@
+package httpv2
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"github.com/gorilla/mux"
+)
+
+// versionRouter serves both versions, as the server would
+func versionRouter(t *testing.T, cfg *Config) *mux.Router {
+	v1, err := httpv1.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	v1.RegisterRoutes(router.PathPrefix("/v1").Subrouter())
+	v2.RegisterRoutes(router.PathPrefix("/v2").Subrouter())
+	return router
+}
+
+func TestSchemas(t *testing.T) {
+	router := versionRouter(t, &Config{})
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantLink   string
+		notLink    string
+	}{
+		{path: "/v1/schemas/event.json", wantStatus: http.StatusOK, wantLink: `"href": "/v1/event/{id}"`, notLink: `"/v2/`},
+		{path: "/v2/schemas/event.json", wantStatus: http.StatusOK, wantLink: `"href": "/v2/event/{id}"`, notLink: `"/v1/`},
+		{path: "/v2/schemas/event_search_params.json", wantStatus: http.StatusOK, wantLink: `"href": "/v2/events"`, notLink: `"/v1/`},
+		{path: "/v2/schemas/event_delete_params.json", wantStatus: http.StatusOK, wantLink: `"href": "/v2/events/delete"`, notLink: `"/v1/`},
+		{path: "/v2/schemas/nothing.json", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			b, _ := io.ReadAll(w.Body)
+			if !strings.Contains(string(b), tt.wantLink) || strings.Contains(string(b), tt.notLink) {
+				t.Fatalf("expected a schema linking with %s, got %s", tt.wantLink, b)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/schema+json" {
+				t.Fatalf("expected a schema content type, got %q", ct)
+			}
+		})
+	}
+}
+
+// fakeStats remembers the keys counters were incremented under
+type fakeStats struct {
+	services.StatsdClient
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (f *fakeStats) Incr(id string, value int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys[id] = true
+	return nil
+}
+
+func (f *fakeStats) PrecisionTiming(id string, value time.Duration) error {
+	return nil
+}
+
+func TestRouteMetricsAreLabelledByVersion(t *testing.T) {
+	stats := &fakeStats{keys: make(map[string]bool)}
+	router := versionRouter(t, &Config{StatsClient: stats})
+	tests := []struct {
+		path    string
+		wantKey string
+	}{
+		{path: "/v1/schemas/event.json", wantKey: "http.v1_schemas.status.200"},
+		{path: "/v2/schemas/event.json", wantKey: "http.v2_schemas.status.200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+			stats.mu.Lock()
+			defer stats.mu.Unlock()
+			if !stats.keys[tt.wantKey] {
+				t.Fatalf("expected %s to be counted, got %v", tt.wantKey, stats.keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Package pb holds the gRPC server every version of the protobuf api is served
+// from. Each version lives in its own package (v1, ...) and registers its services
+// with the Server, whose protobuf package names carry the version, so that several
+// versions may be served side by side from one listener
+package pb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	apihttp "github.com/StabbyCutyou/blunderbuss/api/http"
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// API is implemented by each version of the protobuf api
+type API interface {
+	// Version is the number the api is served under
+	Version() int
+	// RegisterServices adds the api's services to s
+	RegisterServices(s *grpc.Server)
+}
+
+// Closer is implemented by apis with long lived calls, such as streams, which
+// should be ended when the server shuts down rather than holding it up
+type Closer interface {
+	Close()
+}
+
+// Config is the configuration for the Server struct
+type Config struct {
+	Port int
+	// TLS is optional, when it is enabled the api is only served over TLS
+	TLS *apihttp.TLSConfig
+	// MaxMessageSize caps how large a single request message may be. 0 leaves the
+	// grpc default of 4MB
+	MaxMessageSize int
+}
+
+// Server serves every registered version of the protobuf api
+type Server struct {
+	Config   *Config
+	Server   *grpc.Server
+	versions map[int]API
+	tls      bool
+}
+
+// New initializes a new server with no versions registered
+func New(config *Config) (*Server, error) {
+	var opts []grpc.ServerOption
+	if config.MaxMessageSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(config.MaxMessageSize))
+	}
+	if config.TLS.Enabled() {
+		tlsConfig, err := apihttp.NewTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	return &Server{
+		Config:   config,
+		Server:   grpc.NewServer(opts...),
+		versions: make(map[int]API),
+		tls:      config.TLS.Enabled(),
+	}, nil
+}
+
+// Register adds the services of api. Each version may only be registered once,
+// and every version must be registered before Listen is called
+func (s *Server) Register(api API) error {
+	v := api.Version()
+	if _, ok := s.versions[v]; ok {
+		return fmt.Errorf("Protobuf api version %d is already registered", v)
+	}
+	s.versions[v] = api
+	api.RegisterServices(s.Server)
+	return nil
+}
+
+// Versions lists the registered versions, in ascending order
+func (s *Server) Versions() []int {
+	versions := make([]int, 0, len(s.versions))
+	for v := range s.versions {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Listen will serve requests until the server fails, or Shutdown is called. A
+// clean shutdown returns nil
+func (s *Server) Listen() error {
+	l, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", s.Config.Port))
+	if err != nil {
+		return err
+	}
+	if s.tls {
+		logging.Infof("Blunderbuss gRPC listening on %s with TLS, serving versions %v", l.Addr(), s.Versions())
+	} else {
+		logging.Infof("Blunderbuss gRPC listening on %s, serving versions %v", l.Addr(), s.Versions())
+	}
+	// Serve only returns nil once Stop or GracefulStop has been called
+	return s.Server.Serve(l)
+}
+
+// Shutdown stops accepting new connections, and waits for in flight calls to
+// finish until ctx is done. Any still running then are cancelled. Each api which
+// is a Closer is closed first
+func (s *Server) Shutdown(ctx context.Context) error {
+	for _, api := range s.versions {
+		if c, ok := api.(Closer); ok {
+			c.Close()
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Server.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,110 @@
+package pbv1
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+type contextKey int
+
+const apiKeyContextKey contextKey = iota
+
+// apiKeyFromContext returns the key the call was authenticated with, or nil if
+// keys are not being enforced
+func apiKeyFromContext(ctx context.Context) *models.APIKey {
+	k, _ := ctx.Value(apiKeyContextKey).(*models.APIKey)
+	return k
+}
+
+// authorize checks the call's key, and that allowed says it may be used for the
+// method. The returned context carries the key
+func (h *PBApi) authorize(ctx context.Context, allowed func(*models.APIKey) bool) (context.Context, error) {
+	k, err := h.auth.Authorize(bearerToken(ctx), tlsState(ctx), allowed)
+	if err != nil {
+		return ctx, err
+	}
+	if k != nil {
+		ctx = context.WithValue(ctx, apiKeyContextKey, k)
+	}
+	return ctx, nil
+}
+
+// ingest authorizes a call which writes n events. Writes are refused while ingest
+// is paused, and the n events are charged to the API key and client IP rate limits
+func (h *PBApi) ingest(ctx context.Context, n int) (context.Context, error) {
+	ctx, err := h.authorize(ctx, (*models.APIKey).CanIngest)
+	if err != nil {
+		return ctx, err
+	}
+	if h.Config.IngestControl != nil && h.Config.IngestControl.Paused() {
+		return ctx, services.ErrIngestPaused
+	}
+	return ctx, h.auth.LimitClient(apiKeyFromContext(ctx), clientIP(ctx), n)
+}
+
+// authorizeApplication checks that the call's API key may access events for app.
+// When keys are not enforced every application is allowed
+func authorizeApplication(ctx context.Context, app string) error {
+	k := apiKeyFromContext(ctx)
+	if k == nil || k.AllowsApplication(app) {
+		return nil
+	}
+	return services.ErrForbidden
+}
+
+// scopeSearch restricts a search to the applications the call's API key may read
+func scopeSearch(ctx context.Context, p *services.EventSearchParams) error {
+	k := apiKeyFromContext(ctx)
+	if k == nil {
+		return nil
+	}
+	if p.Application != "" && !k.AllowsApplication(p.Application) {
+		return services.ErrForbidden
+	}
+	p.Applications = k.Applications
+	return nil
+}
+
+// bearerToken pulls the key out of "authorization: Bearer <key>" metadata
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, h := range md.Get("authorization") {
+		if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+	}
+	return ""
+}
+
+// tlsState is the state of the call's TLS connection, or nil if it isn't over TLS
+func tlsState(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		return &info.State
+	}
+	return nil
+}
+
+// clientIP is the address of the connecting client, without its port
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,878 @@
+// The blunderbuss gRPC api. Run `make proto` after changing this file to
+// regenerate blunderbuss.pb.go and blunderbuss_grpc.pb.go
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: blunderbuss.proto
+
+package pbv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Event is an instance of a thing that happened
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is assigned by blunderbuss, and is ignored when logging an event
+	Id          string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Application string                 `protobuf:"bytes,2,opt,name=application,proto3" json:"application,omitempty"`
+	Type        string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Message     string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Context     *structpb.Struct       `protobuf:"bytes,5,opt,name=context,proto3" json:"context,omitempty"`
+	StackTrace  string                 `protobuf:"bytes,6,opt,name=stack_trace,json=stackTrace,proto3" json:"stack_trace,omitempty"`
+	CreatedAt   *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// truncated_fields lists the fields that were cut short to fit within our limits
+	TruncatedFields []string `protobuf:"bytes,8,rep,name=truncated_fields,json=truncatedFields,proto3" json:"truncated_fields,omitempty"`
+	// event_id is optional. An event logged again with the same event_id for the
+	// same application, within the retention window, is not stored a second time
+	EventId       string `protobuf:"bytes,9,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_blunderbuss_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetApplication() string {
+	if x != nil {
+		return x.Application
+	}
+	return ""
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Event) GetContext() *structpb.Struct {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+func (x *Event) GetStackTrace() string {
+	if x != nil {
+		return x.StackTrace
+	}
+	return ""
+}
+
+func (x *Event) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Event) GetTruncatedFields() []string {
+	if x != nil {
+		return x.TruncatedFields
+	}
+	return nil
+}
+
+func (x *Event) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+// EventSearchParams filters the events returned by a search. At least one of
+// application, type or message must be set
+type EventSearchParams struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Application string                 `protobuf:"bytes,1,opt,name=application,proto3" json:"application,omitempty"`
+	Type        string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Message     string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	// partial_message matches events whose message contains message, rather than
+	// equals it
+	PartialMessage bool                   `protobuf:"varint,4,opt,name=partial_message,json=partialMessage,proto3" json:"partial_message,omitempty"`
+	Start          *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=start,proto3" json:"start,omitempty"`
+	End            *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=end,proto3" json:"end,omitempty"`
+	// limit is the most events returned. 100 are returned when it is 0, and never
+	// more than 1000
+	Limit int32 `protobuf:"varint,7,opt,name=limit,proto3" json:"limit,omitempty"`
+	// order is "desc", the default, for the newest events first or "asc" for the
+	// oldest first
+	Order string `protobuf:"bytes,8,opt,name=order,proto3" json:"order,omitempty"`
+	// cursor is the next_cursor of the previous page
+	Cursor        string `protobuf:"bytes,9,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventSearchParams) Reset() {
+	*x = EventSearchParams{}
+	mi := &file_blunderbuss_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventSearchParams) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventSearchParams) ProtoMessage() {}
+
+func (x *EventSearchParams) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventSearchParams.ProtoReflect.Descriptor instead.
+func (*EventSearchParams) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EventSearchParams) GetApplication() string {
+	if x != nil {
+		return x.Application
+	}
+	return ""
+}
+
+func (x *EventSearchParams) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *EventSearchParams) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *EventSearchParams) GetPartialMessage() bool {
+	if x != nil {
+		return x.PartialMessage
+	}
+	return false
+}
+
+func (x *EventSearchParams) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *EventSearchParams) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *EventSearchParams) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *EventSearchParams) GetOrder() string {
+	if x != nil {
+		return x.Order
+	}
+	return ""
+}
+
+func (x *EventSearchParams) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type LogEventRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         *Event                 `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogEventRequest) Reset() {
+	*x = LogEventRequest{}
+	mi := &file_blunderbuss_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEventRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEventRequest) ProtoMessage() {}
+
+func (x *LogEventRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEventRequest.ProtoReflect.Descriptor instead.
+func (*LogEventRequest) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LogEventRequest) GetEvent() *Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+type LogEventResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// replayed is true when the event's event_id had already been logged. id is
+	// then that of the event logged the first time
+	Replayed      bool `protobuf:"varint,2,opt,name=replayed,proto3" json:"replayed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogEventResponse) Reset() {
+	*x = LogEventResponse{}
+	mi := &file_blunderbuss_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEventResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEventResponse) ProtoMessage() {}
+
+func (x *LogEventResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEventResponse.ProtoReflect.Descriptor instead.
+func (*LogEventResponse) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *LogEventResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *LogEventResponse) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+type LogEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Events        []*Event               `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogEventsRequest) Reset() {
+	*x = LogEventsRequest{}
+	mi := &file_blunderbuss_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEventsRequest) ProtoMessage() {}
+
+func (x *LogEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEventsRequest.ProtoReflect.Descriptor instead.
+func (*LogEventsRequest) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *LogEventsRequest) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+// LogEventResult is the outcome of a single event given to LogEvents
+type LogEventResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// index is the position of the event in the request
+	Index    int32  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Accepted bool   `protobuf:"varint,2,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Id       string `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	Replayed bool   `protobuf:"varint,4,opt,name=replayed,proto3" json:"replayed,omitempty"`
+	// error says why the event was rejected
+	Error         string `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogEventResult) Reset() {
+	*x = LogEventResult{}
+	mi := &file_blunderbuss_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEventResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEventResult) ProtoMessage() {}
+
+func (x *LogEventResult) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEventResult.ProtoReflect.Descriptor instead.
+func (*LogEventResult) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *LogEventResult) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *LogEventResult) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+func (x *LogEventResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *LogEventResult) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+func (x *LogEventResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type LogEventsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*LogEventResult      `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogEventsResponse) Reset() {
+	*x = LogEventsResponse{}
+	mi := &file_blunderbuss_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEventsResponse) ProtoMessage() {}
+
+func (x *LogEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEventsResponse.ProtoReflect.Descriptor instead.
+func (*LogEventsResponse) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *LogEventsResponse) GetResults() []*LogEventResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type FindEventsResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Events []*Event               `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	// next_cursor is empty when there are no more events to fetch
+	NextCursor    string `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FindEventsResponse) Reset() {
+	*x = FindEventsResponse{}
+	mi := &file_blunderbuss_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FindEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FindEventsResponse) ProtoMessage() {}
+
+func (x *FindEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FindEventsResponse.ProtoReflect.Descriptor instead.
+func (*FindEventsResponse) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *FindEventsResponse) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *FindEventsResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type IngestEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// sequence is chosen by the producer, and must increase with every event sent
+	// on the stream. Sequences start at 1, as 0 is left unset by proto3 and can't
+	// be told apart from a producer forgetting to set it
+	Sequence      uint64 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Event         *Event `protobuf:"bytes,2,opt,name=event,proto3" json:"event,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestEventsRequest) Reset() {
+	*x = IngestEventsRequest{}
+	mi := &file_blunderbuss_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestEventsRequest) ProtoMessage() {}
+
+func (x *IngestEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestEventsRequest.ProtoReflect.Descriptor instead.
+func (*IngestEventsRequest) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *IngestEventsRequest) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *IngestEventsRequest) GetEvent() *Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+// IngestAck acknowledges every event sent up to and including sequence. Each of
+// them has either been stored, or is listed in rejected
+type IngestAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sequence      uint64                 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Rejected      []*IngestRejection     `protobuf:"bytes,2,rep,name=rejected,proto3" json:"rejected,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestAck) Reset() {
+	*x = IngestAck{}
+	mi := &file_blunderbuss_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestAck) ProtoMessage() {}
+
+func (x *IngestAck) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestAck.ProtoReflect.Descriptor instead.
+func (*IngestAck) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *IngestAck) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *IngestAck) GetRejected() []*IngestRejection {
+	if x != nil {
+		return x.Rejected
+	}
+	return nil
+}
+
+// IngestRejection is an event which will never be stored, and should not be sent
+// again as it is
+type IngestRejection struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sequence      uint64                 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestRejection) Reset() {
+	*x = IngestRejection{}
+	mi := &file_blunderbuss_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestRejection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestRejection) ProtoMessage() {}
+
+func (x *IngestRejection) ProtoReflect() protoreflect.Message {
+	mi := &file_blunderbuss_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestRejection.ProtoReflect.Descriptor instead.
+func (*IngestRejection) Descriptor() ([]byte, []int) {
+	return file_blunderbuss_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *IngestRejection) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *IngestRejection) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_blunderbuss_proto protoreflect.FileDescriptor
+
+const file_blunderbuss_proto_rawDesc = "" +
+	"\n" +
+	"\x11blunderbuss.proto\x12\x0eblunderbuss.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xbc\x02\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12 \n" +
+	"\vapplication\x18\x02 \x01(\tR\vapplication\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\x121\n" +
+	"\acontext\x18\x05 \x01(\v2\x17.google.protobuf.StructR\acontext\x12\x1f\n" +
+	"\vstack_trace\x18\x06 \x01(\tR\n" +
+	"stackTrace\x129\n" +
+	"\n" +
+	"created_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12)\n" +
+	"\x10truncated_fields\x18\b \x03(\tR\x0ftruncatedFields\x12\x19\n" +
+	"\bevent_id\x18\t \x01(\tR\aeventId\"\xb0\x02\n" +
+	"\x11EventSearchParams\x12 \n" +
+	"\vapplication\x18\x01 \x01(\tR\vapplication\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12'\n" +
+	"\x0fpartial_message\x18\x04 \x01(\bR\x0epartialMessage\x120\n" +
+	"\x05start\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12\x14\n" +
+	"\x05limit\x18\a \x01(\x05R\x05limit\x12\x14\n" +
+	"\x05order\x18\b \x01(\tR\x05order\x12\x16\n" +
+	"\x06cursor\x18\t \x01(\tR\x06cursor\">\n" +
+	"\x0fLogEventRequest\x12+\n" +
+	"\x05event\x18\x01 \x01(\v2\x15.blunderbuss.v1.EventR\x05event\">\n" +
+	"\x10LogEventResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\breplayed\x18\x02 \x01(\bR\breplayed\"A\n" +
+	"\x10LogEventsRequest\x12-\n" +
+	"\x06events\x18\x01 \x03(\v2\x15.blunderbuss.v1.EventR\x06events\"\x84\x01\n" +
+	"\x0eLogEventResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x1a\n" +
+	"\baccepted\x18\x02 \x01(\bR\baccepted\x12\x0e\n" +
+	"\x02id\x18\x03 \x01(\tR\x02id\x12\x1a\n" +
+	"\breplayed\x18\x04 \x01(\bR\breplayed\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"M\n" +
+	"\x11LogEventsResponse\x128\n" +
+	"\aresults\x18\x01 \x03(\v2\x1e.blunderbuss.v1.LogEventResultR\aresults\"d\n" +
+	"\x12FindEventsResponse\x12-\n" +
+	"\x06events\x18\x01 \x03(\v2\x15.blunderbuss.v1.EventR\x06events\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\"^\n" +
+	"\x13IngestEventsRequest\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x12+\n" +
+	"\x05event\x18\x02 \x01(\v2\x15.blunderbuss.v1.EventR\x05event\"d\n" +
+	"\tIngestAck\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x12;\n" +
+	"\brejected\x18\x02 \x03(\v2\x1f.blunderbuss.v1.IngestRejectionR\brejected\"C\n" +
+	"\x0fIngestRejection\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error2\xd8\x02\n" +
+	"\fEventService\x12M\n" +
+	"\bLogEvent\x12\x1f.blunderbuss.v1.LogEventRequest\x1a .blunderbuss.v1.LogEventResponse\x12P\n" +
+	"\tLogEvents\x12 .blunderbuss.v1.LogEventsRequest\x1a!.blunderbuss.v1.LogEventsResponse\x12S\n" +
+	"\n" +
+	"FindEvents\x12!.blunderbuss.v1.EventSearchParams\x1a\".blunderbuss.v1.FindEventsResponse\x12R\n" +
+	"\fIngestEvents\x12#.blunderbuss.v1.IngestEventsRequest\x1a\x19.blunderbuss.v1.IngestAck(\x010\x01B4Z2github.com/StabbyCutyou/blunderbuss/api/pb/v1;pbv1b\x06proto3"
+
+var (
+	file_blunderbuss_proto_rawDescOnce sync.Once
+	file_blunderbuss_proto_rawDescData []byte
+)
+
+func file_blunderbuss_proto_rawDescGZIP() []byte {
+	file_blunderbuss_proto_rawDescOnce.Do(func() {
+		file_blunderbuss_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_blunderbuss_proto_rawDesc), len(file_blunderbuss_proto_rawDesc)))
+	})
+	return file_blunderbuss_proto_rawDescData
+}
+
+var file_blunderbuss_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_blunderbuss_proto_goTypes = []any{
+	(*Event)(nil),                 // 0: blunderbuss.v1.Event
+	(*EventSearchParams)(nil),     // 1: blunderbuss.v1.EventSearchParams
+	(*LogEventRequest)(nil),       // 2: blunderbuss.v1.LogEventRequest
+	(*LogEventResponse)(nil),      // 3: blunderbuss.v1.LogEventResponse
+	(*LogEventsRequest)(nil),      // 4: blunderbuss.v1.LogEventsRequest
+	(*LogEventResult)(nil),        // 5: blunderbuss.v1.LogEventResult
+	(*LogEventsResponse)(nil),     // 6: blunderbuss.v1.LogEventsResponse
+	(*FindEventsResponse)(nil),    // 7: blunderbuss.v1.FindEventsResponse
+	(*IngestEventsRequest)(nil),   // 8: blunderbuss.v1.IngestEventsRequest
+	(*IngestAck)(nil),             // 9: blunderbuss.v1.IngestAck
+	(*IngestRejection)(nil),       // 10: blunderbuss.v1.IngestRejection
+	(*structpb.Struct)(nil),       // 11: google.protobuf.Struct
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+}
+var file_blunderbuss_proto_depIdxs = []int32{
+	11, // 0: blunderbuss.v1.Event.context:type_name -> google.protobuf.Struct
+	12, // 1: blunderbuss.v1.Event.created_at:type_name -> google.protobuf.Timestamp
+	12, // 2: blunderbuss.v1.EventSearchParams.start:type_name -> google.protobuf.Timestamp
+	12, // 3: blunderbuss.v1.EventSearchParams.end:type_name -> google.protobuf.Timestamp
+	0,  // 4: blunderbuss.v1.LogEventRequest.event:type_name -> blunderbuss.v1.Event
+	0,  // 5: blunderbuss.v1.LogEventsRequest.events:type_name -> blunderbuss.v1.Event
+	5,  // 6: blunderbuss.v1.LogEventsResponse.results:type_name -> blunderbuss.v1.LogEventResult
+	0,  // 7: blunderbuss.v1.FindEventsResponse.events:type_name -> blunderbuss.v1.Event
+	0,  // 8: blunderbuss.v1.IngestEventsRequest.event:type_name -> blunderbuss.v1.Event
+	10, // 9: blunderbuss.v1.IngestAck.rejected:type_name -> blunderbuss.v1.IngestRejection
+	2,  // 10: blunderbuss.v1.EventService.LogEvent:input_type -> blunderbuss.v1.LogEventRequest
+	4,  // 11: blunderbuss.v1.EventService.LogEvents:input_type -> blunderbuss.v1.LogEventsRequest
+	1,  // 12: blunderbuss.v1.EventService.FindEvents:input_type -> blunderbuss.v1.EventSearchParams
+	8,  // 13: blunderbuss.v1.EventService.IngestEvents:input_type -> blunderbuss.v1.IngestEventsRequest
+	3,  // 14: blunderbuss.v1.EventService.LogEvent:output_type -> blunderbuss.v1.LogEventResponse
+	6,  // 15: blunderbuss.v1.EventService.LogEvents:output_type -> blunderbuss.v1.LogEventsResponse
+	7,  // 16: blunderbuss.v1.EventService.FindEvents:output_type -> blunderbuss.v1.FindEventsResponse
+	9,  // 17: blunderbuss.v1.EventService.IngestEvents:output_type -> blunderbuss.v1.IngestAck
+	14, // [14:18] is the sub-list for method output_type
+	10, // [10:14] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_blunderbuss_proto_init() }
+func file_blunderbuss_proto_init() {
+	if File_blunderbuss_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_blunderbuss_proto_rawDesc), len(file_blunderbuss_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_blunderbuss_proto_goTypes,
+		DependencyIndexes: file_blunderbuss_proto_depIdxs,
+		MessageInfos:      file_blunderbuss_proto_msgTypes,
+	}.Build()
+	File_blunderbuss_proto = out.File
+	file_blunderbuss_proto_goTypes = nil
+	file_blunderbuss_proto_depIdxs = nil
+}
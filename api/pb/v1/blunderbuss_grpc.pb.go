@@ -0,0 +1,271 @@
+// The blunderbuss gRPC api. Run `make proto` after changing this file to
+// regenerate blunderbuss.pb.go and blunderbuss_grpc.pb.go
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: blunderbuss.proto
+
+package pbv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EventService_LogEvent_FullMethodName     = "/blunderbuss.v1.EventService/LogEvent"
+	EventService_LogEvents_FullMethodName    = "/blunderbuss.v1.EventService/LogEvents"
+	EventService_FindEvents_FullMethodName   = "/blunderbuss.v1.EventService/FindEvents"
+	EventService_IngestEvents_FullMethodName = "/blunderbuss.v1.EventService/IngestEvents"
+)
+
+// EventServiceClient is the client API for EventService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// EventService logs and searches events. Calls are authenticated with an API
+// key, sent as "authorization: Bearer <key>" metadata, in the same way as the
+// http api
+type EventServiceClient interface {
+	// LogEvent stores a single event
+	LogEvent(ctx context.Context, in *LogEventRequest, opts ...grpc.CallOption) (*LogEventResponse, error)
+	// LogEvents stores many events at once. Events which are invalid, or which the
+	// API key may not write, are rejected individually and the rest are stored
+	// together
+	LogEvents(ctx context.Context, in *LogEventsRequest, opts ...grpc.CallOption) (*LogEventsResponse, error)
+	// FindEvents returns a page of the events matching the search. Pass the
+	// response's next_cursor back in the search to fetch the next page
+	FindEvents(ctx context.Context, in *EventSearchParams, opts ...grpc.CallOption) (*FindEventsResponse, error)
+	// IngestEvents is for producers with a steady, heavy flow of events. The
+	// producer keeps one stream open and sends events on it continuously, and is
+	// sent an IngestAck each time a batch of them has been stored. Events are only
+	// read off the stream as fast as they can be stored, so a producer which gets
+	// ahead of the database will find its sends block.
+	//
+	// If the stream fails, everything after the last acknowledged sequence should
+	// be sent again on a new stream. Giving events an event_id means any that were
+	// stored without being acknowledged aren't stored twice
+	IngestEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[IngestEventsRequest, IngestAck], error)
+}
+
+type eventServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventServiceClient(cc grpc.ClientConnInterface) EventServiceClient {
+	return &eventServiceClient{cc}
+}
+
+func (c *eventServiceClient) LogEvent(ctx context.Context, in *LogEventRequest, opts ...grpc.CallOption) (*LogEventResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LogEventResponse)
+	err := c.cc.Invoke(ctx, EventService_LogEvent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventServiceClient) LogEvents(ctx context.Context, in *LogEventsRequest, opts ...grpc.CallOption) (*LogEventsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LogEventsResponse)
+	err := c.cc.Invoke(ctx, EventService_LogEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventServiceClient) FindEvents(ctx context.Context, in *EventSearchParams, opts ...grpc.CallOption) (*FindEventsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FindEventsResponse)
+	err := c.cc.Invoke(ctx, EventService_FindEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventServiceClient) IngestEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[IngestEventsRequest, IngestAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EventService_ServiceDesc.Streams[0], EventService_IngestEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IngestEventsRequest, IngestAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventService_IngestEventsClient = grpc.BidiStreamingClient[IngestEventsRequest, IngestAck]
+
+// EventServiceServer is the server API for EventService service.
+// All implementations must embed UnimplementedEventServiceServer
+// for forward compatibility.
+//
+// EventService logs and searches events. Calls are authenticated with an API
+// key, sent as "authorization: Bearer <key>" metadata, in the same way as the
+// http api
+type EventServiceServer interface {
+	// LogEvent stores a single event
+	LogEvent(context.Context, *LogEventRequest) (*LogEventResponse, error)
+	// LogEvents stores many events at once. Events which are invalid, or which the
+	// API key may not write, are rejected individually and the rest are stored
+	// together
+	LogEvents(context.Context, *LogEventsRequest) (*LogEventsResponse, error)
+	// FindEvents returns a page of the events matching the search. Pass the
+	// response's next_cursor back in the search to fetch the next page
+	FindEvents(context.Context, *EventSearchParams) (*FindEventsResponse, error)
+	// IngestEvents is for producers with a steady, heavy flow of events. The
+	// producer keeps one stream open and sends events on it continuously, and is
+	// sent an IngestAck each time a batch of them has been stored. Events are only
+	// read off the stream as fast as they can be stored, so a producer which gets
+	// ahead of the database will find its sends block.
+	//
+	// If the stream fails, everything after the last acknowledged sequence should
+	// be sent again on a new stream. Giving events an event_id means any that were
+	// stored without being acknowledged aren't stored twice
+	IngestEvents(grpc.BidiStreamingServer[IngestEventsRequest, IngestAck]) error
+	mustEmbedUnimplementedEventServiceServer()
+}
+
+// UnimplementedEventServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEventServiceServer struct{}
+
+func (UnimplementedEventServiceServer) LogEvent(context.Context, *LogEventRequest) (*LogEventResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LogEvent not implemented")
+}
+func (UnimplementedEventServiceServer) LogEvents(context.Context, *LogEventsRequest) (*LogEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LogEvents not implemented")
+}
+func (UnimplementedEventServiceServer) FindEvents(context.Context, *EventSearchParams) (*FindEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindEvents not implemented")
+}
+func (UnimplementedEventServiceServer) IngestEvents(grpc.BidiStreamingServer[IngestEventsRequest, IngestAck]) error {
+	return status.Errorf(codes.Unimplemented, "method IngestEvents not implemented")
+}
+func (UnimplementedEventServiceServer) mustEmbedUnimplementedEventServiceServer() {}
+func (UnimplementedEventServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeEventServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EventServiceServer will
+// result in compilation errors.
+type UnsafeEventServiceServer interface {
+	mustEmbedUnimplementedEventServiceServer()
+}
+
+func RegisterEventServiceServer(s grpc.ServiceRegistrar, srv EventServiceServer) {
+	// If the following call pancis, it indicates UnimplementedEventServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EventService_ServiceDesc, srv)
+}
+
+func _EventService_LogEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogEventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventServiceServer).LogEvent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventService_LogEvent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventServiceServer).LogEvent(ctx, req.(*LogEventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventService_LogEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventServiceServer).LogEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventService_LogEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventServiceServer).LogEvents(ctx, req.(*LogEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventService_FindEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EventSearchParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EventServiceServer).FindEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EventService_FindEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EventServiceServer).FindEvents(ctx, req.(*EventSearchParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EventService_IngestEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EventServiceServer).IngestEvents(&grpc.GenericServerStream[IngestEventsRequest, IngestAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventService_IngestEventsServer = grpc.BidiStreamingServer[IngestEventsRequest, IngestAck]
+
+// EventService_ServiceDesc is the grpc.ServiceDesc for EventService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EventService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "blunderbuss.v1.EventService",
+	HandlerType: (*EventServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "LogEvent",
+			Handler:    _EventService_LogEvent_Handler,
+		},
+		{
+			MethodName: "LogEvents",
+			Handler:    _EventService_LogEvents_Handler,
+		},
+		{
+			MethodName: "FindEvents",
+			Handler:    _EventService_FindEvents_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IngestEvents",
+			Handler:       _EventService_IngestEvents_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "blunderbuss.proto",
+}
@@ -0,0 +1,93 @@
+package pbv1
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// eventFromPB converts an event sent by a caller. The id and truncated fields are
+// ours to set, so they are ignored. An event without created_at is stamped with
+// the time it was received
+func eventFromPB(pe *Event) (*models.Event, error) {
+	ctxt, err := json.Marshal(pe.GetContext().AsMap())
+	if err != nil {
+		return nil, services.WrapError(services.CodeInvalidRequest, "Malformed event context", err)
+	}
+	createdAt := time.Now()
+	if pe.GetCreatedAt() != nil {
+		if err = pe.GetCreatedAt().CheckValid(); err != nil {
+			return nil, services.WrapError(services.CodeInvalidRequest, "Malformed event created_at", err)
+		}
+		createdAt = pe.GetCreatedAt().AsTime()
+	}
+	return &models.Event{
+		Application:    pe.GetApplication(),
+		Type:           pe.GetType(),
+		Message:        pe.GetMessage(),
+		Context:        ctxt,
+		StackTrace:     pe.GetStackTrace(),
+		CreatedAt:      createdAt,
+		IdempotencyKey: pe.GetEventId(),
+	}, nil
+}
+
+// eventToPB converts a stored event for a response
+func eventToPB(e *models.Event) (*Event, error) {
+	pe := &Event{
+		Id:              e.ID,
+		Application:     e.Application,
+		Type:            e.Type,
+		Message:         e.Message,
+		StackTrace:      e.StackTrace,
+		CreatedAt:       timestamppb.New(e.CreatedAt),
+		TruncatedFields: e.Truncated,
+	}
+	if len(e.Context) > 0 {
+		var ctxt map[string]interface{}
+		if err := json.Unmarshal(e.Context, &ctxt); err != nil {
+			return nil, services.WrapError(services.CodeInternal, "Malformed stored event context", err)
+		}
+		// A context of null unmarshals to a nil map, which is left unset
+		if ctxt != nil {
+			s, err := structpb.NewStruct(ctxt)
+			if err != nil {
+				return nil, services.WrapError(services.CodeInternal, "Unable to convert event context", err)
+			}
+			pe.Context = s
+		}
+	}
+	return pe, nil
+}
+
+// searchParamsFromPB converts a caller's search. Unset times leave the search
+// unbounded at that end
+func searchParamsFromPB(ps *EventSearchParams) *services.EventSearchParams {
+	p := &services.EventSearchParams{
+		Application:    ps.GetApplication(),
+		Type:           ps.GetType(),
+		Message:        ps.GetMessage(),
+		PartialMessage: ps.GetPartialMessage(),
+	}
+	if ps.GetStart() != nil {
+		p.Start = ps.GetStart().AsTime()
+	}
+	if ps.GetEnd() != nil {
+		p.End = ps.GetEnd().AsTime()
+	}
+	return p
+}
+
+// pageParamsFromPB reads which page of a search was asked for. A negative limit
+// is treated as no limit being given, which FindEventsPage replaces with its default
+func pageParamsFromPB(ps *EventSearchParams) *services.EventPageParams {
+	return &services.EventPageParams{
+		Limit:  int(ps.GetLimit()),
+		Order:  ps.GetOrder(),
+		Cursor: ps.GetCursor(),
+	}
+}
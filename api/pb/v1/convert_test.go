@@ -0,0 +1,60 @@
+package pbv1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestEventConversion(t *testing.T) {
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	ctxt, err := structpb.NewStruct(map[string]interface{}{"user": map[string]interface{}{"id": 7.0}, "tags": []interface{}{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := &Event{
+		// The id and truncated fields are ours to set, so a caller's are ignored
+		Id:              "chosen-by-the-client",
+		TruncatedFields: []string{"message"},
+		Application:     "billing",
+		Type:            "error",
+		Message:         "card declined",
+		Context:         ctxt,
+		StackTrace:      "main.go:1",
+		CreatedAt:       timestamppb.New(created),
+		EventId:         "retry-1",
+	}
+	e, err := eventFromPB(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != "" || e.Truncated != nil || e.IdempotencyKey != "retry-1" || !e.CreatedAt.Equal(created) {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	e.ID = "00000000-0000-4000-8000-000000000001"
+	out, err := eventToPB(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.GetId() != e.ID || out.GetMessage() != in.GetMessage() || out.GetStackTrace() != in.GetStackTrace() || !out.GetCreatedAt().AsTime().Equal(created) {
+		t.Fatalf("unexpected event %+v", out)
+	}
+	if !reflect.DeepEqual(out.GetContext().AsMap(), in.GetContext().AsMap()) {
+		t.Fatalf("expected context %v, got %v", in.GetContext().AsMap(), out.GetContext().AsMap())
+	}
+
+	// Events sent without a time are stamped when they arrive
+	e, err = eventFromPB(&Event{Application: "billing", Type: "error"})
+	if err != nil || time.Since(e.CreatedAt) > time.Minute {
+		t.Fatalf("expected the event to be stamped, got %v and %v", e.CreatedAt, err)
+	}
+	// A stored context of null is left unset
+	if out, err = eventToPB(&models.Event{Context: []byte("null")}); err != nil || out.GetContext() != nil {
+		t.Fatalf("expected no context, got %v and %v", out.GetContext(), err)
+	}
+}
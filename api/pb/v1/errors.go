@@ -0,0 +1,84 @@
+package pbv1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// retryAfterTrailer tells the caller how many seconds to wait before retrying, as
+// the Retry-After header does in the http api
+const retryAfterTrailer = "retry-after"
+
+// codeForCode maps a service error code onto the grpc code we report it as
+var codeForCode = map[services.ErrorCode]codes.Code{
+	services.CodeInvalidRequest:   codes.InvalidArgument,
+	services.CodeUnauthorized:     codes.Unauthenticated,
+	services.CodeForbidden:        codes.PermissionDenied,
+	services.CodeNotFound:         codes.NotFound,
+	services.CodeNotAcceptable:    codes.InvalidArgument,
+	services.CodeTooLarge:         codes.InvalidArgument,
+	services.CodeValidationFailed: codes.InvalidArgument,
+	services.CodeRateLimited:      codes.ResourceExhausted,
+	services.CodeUnavailable:      codes.Unavailable,
+	services.CodeInternal:         codes.Internal,
+}
+
+// statusError converts err into a grpc status. Errors that aren't a services.Error
+// are treated as internal faults, and their message is logged rather than returned
+func statusError(ctx context.Context, err error) error {
+	var e *services.Error
+	if !errors.As(err, &e) {
+		logging.Errorf("grpc call %s failed: %s", methodName(ctx), err)
+		return status.Error(codes.Internal, "Internal server error")
+	}
+
+	if e.RetryAfter > 0 {
+		grpc.SetTrailer(ctx, metadata.Pairs(retryAfterTrailer, strconv.Itoa(e.RetryAfterSeconds())))
+	}
+	code, ok := codeForCode[e.Code]
+	if !ok {
+		code = codes.Internal
+	}
+	if code == codes.Internal || code == codes.Unavailable {
+		logging.Errorf("grpc call %s failed: %s", methodName(ctx), err)
+		return status.Error(code, e.Message)
+	}
+	return status.Error(code, errorMessage(e))
+}
+
+// errorMessage describes e to the caller, including which fields failed validation
+func errorMessage(e *services.Error) string {
+	msg := e.Error()
+	if fields, ok := e.Details.([]services.FieldError); ok {
+		for i, f := range fields {
+			sep := ", "
+			if i == 0 {
+				sep = ": "
+			}
+			msg += sep + f.Path + " " + f.Message
+		}
+	}
+	return msg
+}
+
+// rejectionMessage describes why an event was rejected
+func rejectionMessage(err error) string {
+	var e *services.Error
+	if errors.As(err, &e) {
+		return errorMessage(e)
+	}
+	return err.Error()
+}
+
+func methodName(ctx context.Context) string {
+	m, _ := grpc.Method(ctx)
+	return m
+}
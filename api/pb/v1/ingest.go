@@ -0,0 +1,304 @@
+package pbv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultIngestBatchSize is used when Config.IngestBatchSize is not set
+	DefaultIngestBatchSize = 500
+	// DefaultIngestBufferSize is used when Config.IngestBufferSize is not set
+	DefaultIngestBufferSize = 5000
+)
+
+// ingestFlushInterval is the longest an event read off a stream waits to be
+// stored, when too few arrive to fill a batch
+const ingestFlushInterval = 250 * time.Millisecond
+
+// ingestPausePollInterval is how often a paused stream checks whether ingest has
+// been resumed
+const ingestPausePollInterval = 250 * time.Millisecond
+
+// errShuttingDown ends ingest streams when the server is shutting down, so that
+// producers reconnect to another instance
+var errShuttingDown = &services.Error{
+	Code:       services.CodeUnavailable,
+	Message:    "Server is shutting down",
+	RetryAfter: time.Second,
+}
+
+// errZeroSequence ends streams which send a sequence of 0, which is what an unset
+// sequence looks like
+var errZeroSequence = services.NewError(services.CodeInvalidRequest, "Sequence numbers start at 1")
+
+// ingestItem is an event read off a stream, or the reason it was rejected
+type ingestItem struct {
+	sequence uint64
+	event    *models.Event
+	err      error
+}
+
+// IngestEvents reads events off the stream in one goroutine, and stores them in
+// batches in another. They are joined by a buffer of IngestBufferSize events. When
+// storing falls behind the buffer fills, and events stop being read until there
+// is room. The stream's flow control window then fills up too, which is what
+// blocks the producer.
+//
+// While ingest is paused nothing is read or stored, so producers are held back
+// the same way, rather than having their streams ended.
+//
+// An ack is sent after each batch is stored, covering every event read so far,
+// including those rejected. A failure to store a batch ends the stream, and the
+// producer is expected to send everything after its last ack again
+func (h *PBApi) IngestEvents(stream grpc.BidiStreamingServer[IngestEventsRequest, IngestAck]) error {
+	// The rate limits are charged per event as they're read, not for the stream
+	ctx, err := h.authorize(stream.Context(), (*models.APIKey).CanIngest)
+	if err != nil {
+		return statusError(ctx, err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	items := make(chan ingestItem, h.ingestBufferSize())
+	recvErr := make(chan error, 1)
+	go h.receiveEvents(ctx, stream, items, recvErr)
+
+	batchSize := h.ingestBatchSize()
+	batch := make([]*models.Event, 0, batchSize)
+	var rejected []*IngestRejection
+	var last, acked uint64
+	flush := func() error {
+		if err := h.waitWhilePaused(ctx, h.closing); err != nil {
+			return err
+		}
+		if err := h.Config.EventService.LogEvents(batch); err != nil {
+			for _, e := range batch {
+				h.recordRejected(e.Application, err, 1)
+			}
+			return err
+		}
+		if err := stream.Send(&IngestAck{Sequence: last, Rejected: rejected}); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		rejected = nil
+		acked = last
+		return nil
+	}
+	add := func(it ingestItem) error {
+		last = it.sequence
+		if it.err != nil {
+			rejected = append(rejected, &IngestRejection{Sequence: it.sequence, Error: rejectionMessage(it.err)})
+		} else {
+			batch = append(batch, it.event)
+		}
+		if len(batch) >= batchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(ingestFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case it, ok := <-items:
+			if !ok {
+				// The producer has finished, or the stream has broken
+				if err = <-recvErr; err != nil {
+					return streamError(ctx, err)
+				}
+				if last > acked {
+					if err = flush(); err != nil {
+						return streamError(ctx, err)
+					}
+				}
+				return nil
+			}
+			if err = add(it); err != nil {
+				return streamError(ctx, err)
+			}
+		case <-ticker.C:
+			if last > acked {
+				if err = flush(); err != nil {
+					return streamError(ctx, err)
+				}
+			}
+		case <-h.closing:
+			// Store what had been read when the server began shutting down. The
+			// producer sends anything after that again, wherever it reconnects to
+			for n := len(items); n > 0; n-- {
+				it, ok := <-items
+				if !ok {
+					break
+				}
+				if err = add(it); err != nil {
+					return streamError(ctx, err)
+				}
+			}
+			if last > acked {
+				if err = flush(); err != nil {
+					return streamError(ctx, err)
+				}
+			}
+			return statusError(ctx, errShuttingDown)
+		}
+	}
+}
+
+// receiveEvents reads events off the stream until it ends, passing each on to
+// items, which is closed once the stream has ended. Why it ended is then sent on
+// recvErr, which is nil if the producer closed the stream
+func (h *PBApi) receiveEvents(ctx context.Context, stream grpc.BidiStreamingServer[IngestEventsRequest, IngestAck], items chan<- ingestItem, recvErr chan<- error) {
+	defer close(items)
+	limit := func(app string) error {
+		return h.waitForRateLimit(ctx, services.RateLimitApplication, app)
+	}
+	var prev uint64
+	for {
+		// Shutting down is left to the writer, which stores what has been read first
+		if err := h.waitWhilePaused(ctx, nil); err != nil {
+			recvErr <- err
+			return
+		}
+		req, err := stream.Recv()
+		if err == io.EOF {
+			recvErr <- nil
+			return
+		}
+		if err != nil {
+			recvErr <- err
+			return
+		}
+		if req.GetSequence() == 0 {
+			recvErr <- errZeroSequence
+			return
+		}
+		if req.GetSequence() <= prev {
+			recvErr <- services.NewError(services.CodeInvalidRequest, fmt.Sprintf("Sequence numbers must increase, %d was sent after %d", req.GetSequence(), prev))
+			return
+		}
+		prev = req.GetSequence()
+
+		// Rather than reject events over the API key and client IP limits, the
+		// stream is slowed down until they allow them
+		if k := apiKeyFromContext(ctx); k != nil && k.ID != "" {
+			if err = h.waitForRateLimit(ctx, services.RateLimitAPIKey, k.ID); err != nil {
+				recvErr <- err
+				return
+			}
+		}
+		if err = h.waitForRateLimit(ctx, services.RateLimitIP, clientIP(ctx)); err != nil {
+			recvErr <- err
+			return
+		}
+
+		it := ingestItem{sequence: req.GetSequence()}
+		if req.GetEvent() == nil {
+			it.err = services.NewError(services.CodeInvalidRequest, "An event is required")
+			h.recordRejected("", it.err, 1)
+		} else {
+			it.event, it.err = h.prepareEvent(ctx, req.GetEvent(), limit)
+		}
+		if ctx.Err() != nil {
+			recvErr <- ctx.Err()
+			return
+		}
+
+		select {
+		case items <- it:
+		case <-ctx.Done():
+			recvErr <- ctx.Err()
+			return
+		}
+	}
+}
+
+// waitForRateLimit blocks until the rate limit of the given kind allows another
+// event for key, or ctx is done
+func (h *PBApi) waitForRateLimit(ctx context.Context, kind string, key string) error {
+	if h.Config.RateLimiter == nil {
+		return nil
+	}
+	for {
+		ok, wait := h.Config.RateLimiter.Allow(kind, key, 1)
+		if ok {
+			return nil
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// waitWhilePaused blocks while ingest is paused, until ctx is done or closing is
+// closed. closing may be nil
+func (h *PBApi) waitWhilePaused(ctx context.Context, closing <-chan struct{}) error {
+	if h.Config.IngestControl == nil {
+		return nil
+	}
+	for h.Config.IngestControl.Paused() {
+		t := time.NewTimer(ingestPausePollInterval)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-closing:
+			t.Stop()
+			return errShuttingDown
+		}
+	}
+	return nil
+}
+
+// Close ends every open ingest stream, once it has stored the events it had read.
+// It is called when the server shuts down, as streams would otherwise hold it up
+func (h *PBApi) Close() {
+	h.closeOnce.Do(func() {
+		close(h.closing)
+	})
+}
+
+func (h *PBApi) ingestBatchSize() int {
+	if h.Config.IngestBatchSize > 0 {
+		return h.Config.IngestBatchSize
+	}
+	return DefaultIngestBatchSize
+}
+
+func (h *PBApi) ingestBufferSize() int {
+	if h.Config.IngestBufferSize > 0 {
+		return h.Config.IngestBufferSize
+	}
+	return DefaultIngestBufferSize
+}
+
+// streamError converts err into a grpc status to end a stream with. Errors that
+// came from the stream itself, such as the producer cancelling it, already are one
+func streamError(ctx context.Context, err error) error {
+	var e *services.Error
+	if errors.As(err, &e) {
+		return statusError(ctx, err)
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return status.FromContextError(err).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return statusError(ctx, err)
+}
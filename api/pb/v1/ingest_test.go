@@ -0,0 +1,397 @@
+package pbv1
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeEventService stores events in memory. Events without a type fail to prepare
+type fakeEventService struct {
+	services.IEventLoggingService
+	mu     sync.Mutex
+	stored []*models.Event
+	err    error
+}
+
+func (f *fakeEventService) PrepareEvent(e *models.Event) error {
+	if e.Type == "" {
+		return services.NewError(services.CodeValidationFailed, "Event is missing a type")
+	}
+	return nil
+}
+
+func (f *fakeEventService) LogEvent(e *models.Event) error {
+	return f.LogEvents([]*models.Event{e})
+}
+
+func (f *fakeEventService) LogEvents(es []*models.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.stored = append(f.stored, es...)
+	return nil
+}
+
+func (f *fakeEventService) storedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.stored)
+}
+
+// fakeStream is the server side of an ingest stream. Closing reqs is the producer
+// closing its side, and recvs counts the calls made to Recv
+type fakeStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	reqs  chan *IngestEventsRequest
+	acks  chan *IngestAck
+	recvs int32
+}
+
+func newFakeStream(t *testing.T, ctx context.Context) *fakeStream {
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	return &fakeStream{ctx: ctx, reqs: make(chan *IngestEventsRequest, 100), acks: make(chan *IngestAck, 100)}
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeStream) Recv() (*IngestEventsRequest, error) {
+	atomic.AddInt32(&s.recvs, 1)
+	select {
+	case req, ok := <-s.reqs:
+		if !ok {
+			return nil, io.EOF
+		}
+		return req, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *fakeStream) Send(ack *IngestAck) error {
+	s.acks <- ack
+	return nil
+}
+
+// run starts the stream, returning what it ends with
+func (s *fakeStream) run(h *PBApi) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- h.IngestEvents(s) }()
+	return done
+}
+
+// waitForRecvs blocks until Recv has been called n times
+func (s *fakeStream) waitForRecvs(t *testing.T, n int32) {
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&s.recvs) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Recv was only called %d times", atomic.LoadInt32(&s.recvs))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func ingestRequest(seq uint64, typ string) *IngestEventsRequest {
+	return &IngestEventsRequest{Sequence: seq, Event: &Event{Application: "billing", Type: typ, Message: "boom"}}
+}
+
+func waitForEnd(t *testing.T, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream never ended")
+		return nil
+	}
+}
+
+func TestIngestEventsProtocol(t *testing.T) {
+	tests := []struct {
+		name         string
+		batchSize    int
+		reqs         []*IngestEventsRequest
+		storeErr     error
+		wantAcks     []uint64
+		wantRejected []uint64
+		wantStored   int
+		wantCode     codes.Code
+		wantMessage  string
+	}{
+		{
+			name:       "acked once the producer is done",
+			reqs:       []*IngestEventsRequest{ingestRequest(1, "error"), ingestRequest(2, "error"), ingestRequest(3, "error")},
+			wantAcks:   []uint64{3},
+			wantStored: 3,
+		},
+		{
+			name:       "acked after each full batch",
+			batchSize:  2,
+			reqs:       []*IngestEventsRequest{ingestRequest(1, "error"), ingestRequest(2, "error"), ingestRequest(3, "error"), ingestRequest(4, "error"), ingestRequest(5, "error")},
+			wantAcks:   []uint64{2, 4, 5},
+			wantStored: 5,
+		},
+		{
+			name:       "sequences may skip",
+			reqs:       []*IngestEventsRequest{ingestRequest(10, "error"), ingestRequest(20, "error")},
+			wantAcks:   []uint64{20},
+			wantStored: 2,
+		},
+		{
+			name:         "rejections are acked with the events around them",
+			reqs:         []*IngestEventsRequest{ingestRequest(1, "error"), ingestRequest(2, ""), {Sequence: 3}, ingestRequest(4, "error")},
+			wantAcks:     []uint64{4},
+			wantRejected: []uint64{2, 3},
+			wantStored:   2,
+		},
+		{
+			name:         "a batch of only rejections is still acked",
+			reqs:         []*IngestEventsRequest{ingestRequest(1, "")},
+			wantAcks:     []uint64{1},
+			wantRejected: []uint64{1},
+		},
+		{
+			name:     "sequence goes backwards",
+			reqs:     []*IngestEventsRequest{ingestRequest(1, "error"), ingestRequest(5, "error"), ingestRequest(3, "error")},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "sequence repeats",
+			reqs:     []*IngestEventsRequest{ingestRequest(1, "error"), ingestRequest(1, "error")},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:       "first sequence may be anything above zero",
+			reqs:       []*IngestEventsRequest{ingestRequest(1000, "error"), ingestRequest(1001, "error")},
+			wantAcks:   []uint64{1001},
+			wantStored: 2,
+		},
+		{
+			name:        "sequence starts at zero",
+			reqs:        []*IngestEventsRequest{ingestRequest(0, "error")},
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "Sequence numbers start at 1",
+		},
+		{
+			name:        "sequence left unset",
+			reqs:        []*IngestEventsRequest{{Event: &Event{Application: "billing", Type: "error", Message: "boom"}}},
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "Sequence numbers start at 1",
+		},
+		{
+			name:        "zero after other sequences",
+			reqs:        []*IngestEventsRequest{ingestRequest(1, "error"), ingestRequest(0, "error")},
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "Sequence numbers start at 1",
+		},
+		{
+			name:     "storing fails",
+			reqs:     []*IngestEventsRequest{ingestRequest(1, "error")},
+			storeErr: services.NewError(services.CodeUnavailable, "Database unavailable"),
+			wantCode: codes.Unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := &fakeEventService{err: tt.storeErr}
+			h, err := New(&Config{EventService: events, IngestBatchSize: tt.batchSize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newFakeStream(t, context.Background())
+			for _, req := range tt.reqs {
+				s.reqs <- req
+			}
+			close(s.reqs)
+
+			err = waitForEnd(t, s.run(h))
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("expected the stream to end with %s, got %v", tt.wantCode, err)
+			}
+			if tt.wantMessage != "" && status.Convert(err).Message() != tt.wantMessage {
+				t.Fatalf("expected the stream to end with %q, got %q", tt.wantMessage, status.Convert(err).Message())
+			}
+			close(s.acks)
+			var acks, rejected []uint64
+			for ack := range s.acks {
+				acks = append(acks, ack.GetSequence())
+				for _, r := range ack.GetRejected() {
+					rejected = append(rejected, r.GetSequence())
+				}
+			}
+			if !reflect.DeepEqual(acks, tt.wantAcks) || !reflect.DeepEqual(rejected, tt.wantRejected) {
+				t.Fatalf("expected acks %v rejecting %v, got %v rejecting %v", tt.wantAcks, tt.wantRejected, acks, rejected)
+			}
+			if n := events.storedCount(); n != tt.wantStored {
+				t.Fatalf("expected %d events stored, got %d", tt.wantStored, n)
+			}
+		})
+	}
+}
+
+func TestIngestEventsWaitsWhilePaused(t *testing.T) {
+	events := &fakeEventService{}
+	control := services.NewIngestControl()
+	control.Pause()
+	h, err := New(&Config{EventService: events, IngestControl: control})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeStream(t, context.Background())
+	s.reqs <- ingestRequest(1, "error")
+	close(s.reqs)
+	done := s.run(h)
+
+	select {
+	case err = <-done:
+		t.Fatalf("expected the stream to stay open while paused, it ended with %v", err)
+	case ack := <-s.acks:
+		t.Fatalf("expected nothing to be stored while paused, got an ack for %d", ack.GetSequence())
+	case <-time.After(2 * ingestPausePollInterval):
+	}
+	if n := atomic.LoadInt32(&s.recvs); n != 0 {
+		t.Fatalf("expected nothing to be read while paused, Recv was called %d times", n)
+	}
+
+	control.Resume()
+	if err = waitForEnd(t, done); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ack := <-s.acks; ack.GetSequence() != 1 || events.storedCount() != 1 {
+		t.Fatalf("expected event 1 to be stored and acked, got an ack for %d and %d stored", ack.GetSequence(), events.storedCount())
+	}
+}
+
+func TestIngestEventsStoresWhatWasReadOnClose(t *testing.T) {
+	events := &fakeEventService{}
+	h, err := New(&Config{EventService: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeStream(t, context.Background())
+	for seq := uint64(1); seq <= 3; seq++ {
+		s.reqs <- ingestRequest(seq, "error")
+	}
+	done := s.run(h)
+	// The fourth call blocks, as the producer hasn't sent anything more
+	s.waitForRecvs(t, 4)
+	h.Close()
+
+	if err = waitForEnd(t, done); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the stream to end as unavailable, got %v", err)
+	}
+	close(s.acks)
+	var last uint64
+	for ack := range s.acks {
+		last = ack.GetSequence()
+	}
+	if last != 3 || events.storedCount() != 3 {
+		t.Fatalf("expected all 3 events stored and acked, got an ack for %d and %d stored", last, events.storedCount())
+	}
+}
+
+// countingLimiter allows everything, and counts what was charged to each kind of limit
+type countingLimiter struct {
+	mu      sync.Mutex
+	charged map[string]int
+}
+
+func (c *countingLimiter) Allow(kind string, key string, n int) (bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.charged[kind] += n
+	return true, 0
+}
+
+// fakeKeyService knows a single key, "good", which may write to billing
+type fakeKeyService struct {
+	services.IAPIKeyService
+}
+
+func (f *fakeKeyService) Authenticate(rawKey string) (*models.APIKey, error) {
+	if rawKey != "good" {
+		return nil, services.ErrUnauthorized
+	}
+	return &models.APIKey{ID: "k1", Scope: models.ScopeReadWrite, Applications: []string{"billing"}}, nil
+}
+
+func TestIngestChargesPerEvent(t *testing.T) {
+	events := []*Event{
+		{Application: "billing", Type: "error"},
+		{Application: "billing", Type: "error"},
+		{Application: "billing", Type: "error"},
+	}
+	tests := []struct {
+		name string
+		call func(h *PBApi, ctx context.Context) error
+		want int
+	}{
+		{name: "LogEvent", want: 1, call: func(h *PBApi, ctx context.Context) error {
+			_, err := h.LogEvent(ctx, &LogEventRequest{Event: events[0]})
+			return err
+		}},
+		{name: "LogEvents", want: 3, call: func(h *PBApi, ctx context.Context) error {
+			_, err := h.LogEvents(ctx, &LogEventsRequest{Events: events})
+			return err
+		}},
+		{name: "IngestEvents", want: 3, call: func(h *PBApi, ctx context.Context) error {
+			s := newFakeStream(t, ctx)
+			for i, e := range events {
+				s.reqs <- &IngestEventsRequest{Sequence: uint64(i + 1), Event: e}
+			}
+			close(s.reqs)
+			return waitForEnd(t, s.run(h))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &countingLimiter{charged: make(map[string]int)}
+			h, err := New(&Config{
+				EventService:   &fakeEventService{},
+				KeyService:     &fakeKeyService{},
+				RequireAPIKeys: true,
+				RateLimiter:    limiter,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer good"))
+			if err = tt.call(h, ctx); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			want := map[string]int{services.RateLimitAPIKey: tt.want, services.RateLimitIP: tt.want, services.RateLimitApplication: tt.want}
+			if !reflect.DeepEqual(limiter.charged, want) {
+				t.Fatalf("expected %v to be charged, got %v", want, limiter.charged)
+			}
+		})
+	}
+
+	// A failed call is not charged for
+	limiter := &countingLimiter{charged: make(map[string]int)}
+	h, err := New(&Config{EventService: &fakeEventService{}, KeyService: &fakeKeyService{}, RequireAPIKeys: true, RateLimiter: limiter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = h.LogEvents(context.Background(), &LogEventsRequest{Events: events}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the call to be unauthenticated, got %v", err)
+	}
+	if len(limiter.charged) != 0 {
+		t.Fatalf("expected nothing to be charged, got %v", limiter.charged)
+	}
+}
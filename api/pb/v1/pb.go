@@ -1 +1,216 @@
+// Package pbv1 is version 1 of the protobuf api, served over gRPC. The messages and
+// service are defined in blunderbuss.proto, and the code generated from it lives
+// alongside this file. Calls are authenticated, authorized and rate limited in the
+// same way as the http api, and are backed by the same services
 package pbv1
+
+import (
+	"context"
+	"sync"
+
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1/middleware"
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"google.golang.org/grpc"
+)
+
+// PBApi represents the object used to govern gRPC calls into the system
+type PBApi struct {
+	UnimplementedEventServiceServer
+	Config *Config
+	auth   *middleware.Manager
+	// closing is closed by Close, to end open ingest streams
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Config is the configuration for the PBApi struct
+type Config struct {
+	EventService  services.IEventLoggingService
+	MetricService services.IMetricLoggingService
+	KeyService    services.IAPIKeyService
+	// RequireAPIKeys turns on enforcement of the authorization metadata
+	RequireAPIKeys bool
+	// ClientCertApplications maps the CN or a SAN of a verified client certificate
+	// to the applications that client may access
+	ClientCertApplications map[string][]string
+	// RateLimiter is optional, when set ingest is rate limited
+	RateLimiter services.IRateLimitService
+	// IngestControl is optional, when set writes are refused while it is paused
+	IngestControl services.IIngestControl
+	// IngestBatchSize is the most events IngestEvents stores at once, and
+	// IngestBufferSize how many it will read ahead of storing them. Defaults are
+	// used when they are 0
+	IngestBatchSize  int
+	IngestBufferSize int
+}
+
+// New initializes a new protobuf api
+func New(config *Config) (*PBApi, error) {
+	// Only the manager's authentication and rate limits are used, errors are reported as grpc statuses
+	m, err := middleware.NewManager(&middleware.ManagerConfig{
+		KeyService:             config.KeyService,
+		RequireAPIKeys:         config.RequireAPIKeys,
+		ClientCertApplications: config.ClientCertApplications,
+		RateLimiter:            config.RateLimiter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PBApi{Config: config, auth: m, closing: make(chan struct{})}, nil
+}
+
+// Version is the version of the api this package serves
+func (h *PBApi) Version() int {
+	return 1
+}
+
+// RegisterServices adds the EventService to s
+func (h *PBApi) RegisterServices(s *grpc.Server) {
+	RegisterEventServiceServer(s, h)
+}
+
+// LogEvent stores a single event, reporting the id it was stored under
+func (h *PBApi) LogEvent(ctx context.Context, req *LogEventRequest) (*LogEventResponse, error) {
+	ctx, err := h.ingest(ctx, 1)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	if req.GetEvent() == nil {
+		err = services.NewError(services.CodeInvalidRequest, "An event is required")
+		h.recordRejected("", err, 1)
+		return nil, statusError(ctx, err)
+	}
+	e, err := eventFromPB(req.GetEvent())
+	if err != nil {
+		h.recordRejected("", err, 1)
+		return nil, statusError(ctx, err)
+	}
+
+	if err = authorizeApplication(ctx, e.Application); err != nil {
+		h.recordRejected("", err, 1)
+		return nil, statusError(ctx, err)
+	}
+	if err = h.limitApplication(e.Application); err != nil {
+		h.recordRejected(e.Application, err, 1)
+		return nil, statusError(ctx, err)
+	}
+	if err = h.Config.EventService.LogEvent(e); err != nil {
+		h.recordRejected(e.Application, err, 1)
+		return nil, statusError(ctx, err)
+	}
+	return &LogEventResponse{Id: e.ID, Replayed: e.Replayed}, nil
+}
+
+// LogEvents logs every acceptable event in a single transaction. Events which
+// fail to convert, or that the caller's API key may not write, are rejected
+// individually
+func (h *PBApi) LogEvents(ctx context.Context, req *LogEventsRequest) (*LogEventsResponse, error) {
+	ctx, err := h.ingest(ctx, len(req.GetEvents()))
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	results := make([]*LogEventResult, len(req.GetEvents()))
+	evts := make([]*models.Event, 0, len(req.GetEvents()))
+	accepted := make([]int, 0, len(req.GetEvents()))
+	for i, pe := range req.GetEvents() {
+		results[i] = &LogEventResult{Index: int32(i)}
+		e, err := h.prepareEvent(ctx, pe, h.limitApplication)
+		if err != nil {
+			results[i].Error = rejectionMessage(err)
+			continue
+		}
+		results[i].Accepted = true
+		evts = append(evts, e)
+		accepted = append(accepted, i)
+	}
+
+	if err := h.Config.EventService.LogEvents(evts); err != nil {
+		for _, e := range evts {
+			h.recordRejected(e.Application, err, 1)
+		}
+		return nil, statusError(ctx, err)
+	}
+	for j, i := range accepted {
+		results[i].Id = evts[j].ID
+		results[i].Replayed = evts[j].Replayed
+	}
+	return &LogEventsResponse{Results: results}, nil
+}
+
+// prepareEvent converts, authorizes and validates a single event of a batch,
+// recording why it was rejected if it was. limit applies the application's rate
+// limit to the event
+func (h *PBApi) prepareEvent(ctx context.Context, pe *Event, limit func(app string) error) (*models.Event, error) {
+	if pe == nil {
+		err := services.NewError(services.CodeInvalidRequest, "Events may not be empty")
+		h.recordRejected("", err, 1)
+		return nil, err
+	}
+	e, err := eventFromPB(pe)
+	if err != nil {
+		h.recordRejected("", err, 1)
+		return nil, err
+	}
+	if err = authorizeApplication(ctx, e.Application); err != nil {
+		h.recordRejected("", err, 1)
+		return nil, err
+	}
+	if err = limit(e.Application); err != nil {
+		h.recordRejected(e.Application, err, 1)
+		return nil, err
+	}
+	if err = h.Config.EventService.PrepareEvent(e); err != nil {
+		h.recordRejected(e.Application, err, 1)
+		return nil, err
+	}
+	return e, nil
+}
+
+// FindEvents returns a single page of the events matching the search, along with
+// the cursor for the next page, so that no response grows past the message size
+// limit
+func (h *PBApi) FindEvents(ctx context.Context, req *EventSearchParams) (*FindEventsResponse, error) {
+	ctx, err := h.authorize(ctx, (*models.APIKey).CanRead)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	p := searchParamsFromPB(req)
+	if err = scopeSearch(ctx, p); err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	page, err := h.Config.EventService.FindEventsPage(p, pageParamsFromPB(req))
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	resp := &FindEventsResponse{Events: make([]*Event, 0, len(page.Events)), NextCursor: page.NextCursor}
+	for i := range page.Events {
+		pe, err := eventToPB(&page.Events[i])
+		if err != nil {
+			return nil, statusError(ctx, err)
+		}
+		resp.Events = append(resp.Events, pe)
+	}
+	return resp, nil
+}
+
+// recordRejected counts n events refused with err. app should be empty unless the
+// call has been authorized to write to it
+func (h *PBApi) recordRejected(app string, err error, n int) {
+	if h.Config.MetricService != nil {
+		h.Config.MetricService.RecordRejected(app, string(services.ErrorCodeOf(err)), n)
+	}
+}
+
+// limitApplication takes a token from the application's rate limit
+func (h *PBApi) limitApplication(app string) error {
+	if h.Config.RateLimiter == nil {
+		return nil
+	}
+	if ok, wait := h.Config.RateLimiter.Allow(services.RateLimitApplication, app, 1); !ok {
+		return services.NewRateLimitedError(services.RateLimitApplication, wait)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package pbv1
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeSearchService returns page for every search, and remembers what it was asked
+type fakeSearchService struct {
+	services.IEventLoggingService
+	page *services.EventPage
+	err  error
+	p    *services.EventSearchParams
+	pg   *services.EventPageParams
+}
+
+func (f *fakeSearchService) FindEventsPage(p *services.EventSearchParams, pg *services.EventPageParams) (*services.EventPage, error) {
+	f.p, f.pg = p, pg
+	return f.page, f.err
+}
+
+func TestFindEvents(t *testing.T) {
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	evts := []models.Event{
+		{ID: "00000000-0000-4000-8000-000000000002", Application: "billing", Type: "error", CreatedAt: created},
+		{ID: "00000000-0000-4000-8000-000000000001", Application: "billing", Type: "error", CreatedAt: created.Add(-time.Minute)},
+	}
+
+	tests := []struct {
+		name           string
+		req            *EventSearchParams
+		page           *services.EventPage
+		err            error
+		wantPage       *services.EventPageParams
+		wantIDs        []string
+		wantNextCursor string
+		wantCode       codes.Code
+	}{
+		{
+			name:           "first page",
+			req:            &EventSearchParams{Application: "billing", Limit: 2},
+			page:           &services.EventPage{Events: evts, NextCursor: "next"},
+			wantPage:       &services.EventPageParams{Limit: 2},
+			wantIDs:        []string{evts[0].ID, evts[1].ID},
+			wantNextCursor: "next",
+		},
+		{
+			name:     "last page",
+			req:      &EventSearchParams{Application: "billing", Order: "asc", Cursor: "next"},
+			page:     &services.EventPage{Events: evts[1:]},
+			wantPage: &services.EventPageParams{Order: "asc", Cursor: "next"},
+			wantIDs:  []string{evts[1].ID},
+		},
+		{
+			name:     "empty page",
+			req:      &EventSearchParams{Type: "error"},
+			page:     &services.EventPage{Events: []models.Event{}},
+			wantPage: &services.EventPageParams{},
+			wantIDs:  []string{},
+		},
+		{
+			name:     "invalid cursor",
+			req:      &EventSearchParams{Application: "billing", Cursor: "bogus"},
+			err:      services.ErrInvalidCursor,
+			wantPage: &services.EventPageParams{Cursor: "bogus"},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &fakeSearchService{page: tt.page, err: tt.err}
+			h, err := New(&Config{EventService: es})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := h.FindEvents(context.Background(), tt.req)
+			if !reflect.DeepEqual(es.pg, tt.wantPage) {
+				t.Fatalf("expected page %+v, got %+v", tt.wantPage, es.pg)
+			}
+			if tt.wantCode != codes.OK {
+				if status.Code(err) != tt.wantCode {
+					t.Fatalf("expected a %s status, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			ids := make([]string, 0, len(resp.GetEvents()))
+			for _, e := range resp.GetEvents() {
+				ids = append(ids, e.GetId())
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || resp.GetNextCursor() != tt.wantNextCursor {
+				t.Fatalf("expected events %v and cursor %q, got %v and %q", tt.wantIDs, tt.wantNextCursor, ids, resp.GetNextCursor())
+			}
+		})
+	}
+}
+
+func TestLogEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *LogEventRequest
+		err      error
+		wantCode codes.Code
+	}{
+		{name: "stored", req: &LogEventRequest{Event: &Event{Application: "billing", Type: "error", EventId: "retry-1"}}},
+		{name: "no event", req: &LogEventRequest{}, wantCode: codes.InvalidArgument},
+		{name: "invalid created_at", req: &LogEventRequest{Event: &Event{Application: "billing", Type: "error", CreatedAt: &timestamppb.Timestamp{Nanos: -1}}}, wantCode: codes.InvalidArgument},
+		{name: "database down", req: &LogEventRequest{Event: &Event{Application: "billing", Type: "error"}}, err: services.NewError(services.CodeUnavailable, "Database unavailable"), wantCode: codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &fakeEventService{err: tt.err}
+			h, err := New(&Config{EventService: es})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := h.LogEvent(context.Background(), tt.req)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("expected a %s status, got %v", tt.wantCode, err)
+			}
+			if tt.wantCode != codes.OK {
+				if es.storedCount() != 0 {
+					t.Fatal("expected nothing to be stored")
+				}
+				return
+			}
+			if es.storedCount() != 1 || resp.GetId() != es.stored[0].ID || es.stored[0].IdempotencyKey != "retry-1" {
+				t.Fatalf("expected the event to be stored with its event_id, got %+v and %+v", resp, es.stored)
+			}
+		})
+	}
+}
+
+func TestLogEvents(t *testing.T) {
+	es := &fakeEventService{}
+	h, err := New(&Config{EventService: es})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := h.LogEvents(context.Background(), &LogEventsRequest{Events: []*Event{
+		{Application: "billing", Type: "error"},
+		nil,
+		{Application: "billing"},
+		{Application: "billing", Type: "deploy"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bad events are rejected on their own, and the rest stored together
+	wantAccepted := []bool{true, false, false, true}
+	for i, res := range resp.GetResults() {
+		if res.GetIndex() != int32(i) || res.GetAccepted() != wantAccepted[i] || res.GetAccepted() == (res.GetError() != "") {
+			t.Fatalf("unexpected result %d: %+v", i, res)
+		}
+	}
+	if len(resp.GetResults()) != len(wantAccepted) || es.storedCount() != 2 {
+		t.Fatalf("expected 2 of 4 events stored, got %d results and %d stored", len(resp.GetResults()), es.storedCount())
+	}
+
+	es.err = services.NewError(services.CodeUnavailable, "Database unavailable")
+	if _, err = h.LogEvents(context.Background(), &LogEventsRequest{Events: []*Event{{Application: "billing", Type: "error"}}}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the whole batch to fail, got %v", err)
+	}
+}
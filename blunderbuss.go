@@ -3,29 +3,66 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/StabbyCutyou/blunderbuss/boot"
 	"github.com/StabbyCutyou/blunderbuss/config"
+	"github.com/StabbyCutyou/blunderbuss/logging"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
-const Version = "0.0.1"
-
 func main() {
 	// TODO incorporate extracted logging solution?
 	log.SetOutput(os.Stdout)
-	log.Printf("Blunderbuss v%s starting up...", Version)
+	logging.Infof("Blunderbuss v%s (%s) starting up...", boot.Version, boot.Sha)
 
 	bp, err := boot.Boot()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	listenErr := make(chan error, 3)
+	go func() {
+		listenErr <- bp.HTTPServer.Listen()
+	}()
+	if bp.PBServer != nil {
+		go func() {
+			listenErr <- bp.PBServer.Listen()
+		}()
+	}
+	if bp.AdminServer != nil {
+		go func() {
+			listenErr <- bp.AdminServer.Listen()
+		}()
+	}
+
 	// This will only return if something interrupts it
-	log.Fatal(bp.HTTPServer.Listen())
+	select {
+	case err = <-listenErr:
+		logging.Errorf("Blunderbuss stopped serving: %s", err)
+	case sig := <-signals:
+		logging.Infof("Blunderbuss received %s, shutting down...", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bp.Config.ShutdownTimeout*time.Second)
+	defer cancel()
+	if shutdownErr := bp.Shutdown(ctx); shutdownErr != nil {
+		logging.Errorf("Blunderbuss did not shut down cleanly: %s", shutdownErr)
+		os.Exit(1)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+	logging.Infof("Blunderbuss shut down")
 }
 
 func openDB(cfg *config.Config) (*sqlx.DB, error) {
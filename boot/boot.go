@@ -4,18 +4,46 @@
 package boot
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/api/admin"
+	apihttp "github.com/StabbyCutyou/blunderbuss/api/http"
 	"github.com/StabbyCutyou/blunderbuss/api/http/v1"
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1/middleware"
+	apipb "github.com/StabbyCutyou/blunderbuss/api/pb"
+	"github.com/StabbyCutyou/blunderbuss/api/pb/v1"
 	"github.com/StabbyCutyou/blunderbuss/config"
+	"github.com/StabbyCutyou/blunderbuss/logging"
 	"github.com/StabbyCutyou/blunderbuss/services"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
+// Version is the version of blunderbuss
+const Version = "0.0.1"
+
+// Sha is the git commit blunderbuss was built from. It is set at build time, see the Makefile
+var Sha string
+
 // Payload contains all the artifacts of a successfully booted system
 type Payload struct {
 	MetricService services.IMetricLoggingService
 	EventService  services.IEventLoggingService
-	HTTPServer    *httpv1.HTTPApi
+	Broadcaster   services.IEventBroadcaster
+	KeyService    services.IAPIKeyService
+	IngestControl services.IIngestControl
+	HTTPServer    *apihttp.Server
+	// PBServer is nil when the protobuf api is disabled
+	PBServer *apipb.Server
+	// AdminServer is nil when the admin endpoints are disabled
+	AdminServer *admin.Server
+	Statsd      services.StatsdClient
+	DB          *sqlx.DB
+	Config      *config.Config
 }
 
 // Boot will boot the application, and return an error if something went wrong
@@ -32,25 +60,51 @@ func Boot() (*Payload, error) {
 	if err != nil {
 		return nil, err
 	}
+	logLevel, err := logging.ParseLevel(globalCfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	logging.SetLevel(logLevel)
 
 	db, err := openDB(globalCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	statsd := services.NewStatsdClient(&services.StatsdConfig{
+	statsdCfg := &services.StatsdConfig{
 		Prefix:        globalCfg.StatsdPrefix,
 		Address:       globalCfg.StatsdAddress,
 		FlushInterval: int(globalCfg.StatsdInterval.Seconds()),
 		Type:          "statsd",
-		Enabled:       false,
-	})
+		Enabled:       globalCfg.StatsdEnabled,
+	}
+	statsd := services.NewStatsdClient(statsdCfg)
 	if err != nil {
 		return nil, err
 	}
 
+	var prometheus *services.PrometheusMetrics
+	if globalCfg.PrometheusEnabled {
+		prometheus, err = services.NewPrometheusMetrics(&services.PrometheusConfig{
+			DB:              db,
+			MaxApplications: globalCfg.PrometheusMaxApplications,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	metricService, err := services.NewMetricLoggingService(&services.MetricLoggingServiceConfig{
-		Statsd: statsd,
+		Statsd:          statsd,
+		Prometheus:      prometheus,
+		MaxApplications: globalCfg.StatsdMaxApplications,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	broadcaster, err := services.NewEventBroadcaster(&services.EventBroadcasterConfig{
+		BufferSize: globalCfg.StreamBufferSize,
 	})
 	if err != nil {
 		return nil, err
@@ -59,27 +113,272 @@ func Boot() (*Payload, error) {
 	eventService, err := services.NewEventLoggingService(&services.EventLoggingServiceConfig{
 		DB:            db,
 		MetricService: metricService,
+		Broadcaster:   broadcaster,
+		Limits: services.EventLimits{
+			MaxApplicationLength: globalCfg.MaxApplicationLength,
+			MaxTypeLength:        globalCfg.MaxTypeLength,
+			MaxMessageLength:     globalCfg.MaxMessageLength,
+			MaxStackTraceLength:  globalCfg.MaxStackTraceLength,
+			MaxContextDepth:      globalCfg.MaxContextDepth,
+			MaxContextKeys:       globalCfg.MaxContextKeys,
+			RequiredFields:       splitList(globalCfg.RequiredEventFields),
+		},
+		DeleteBatchSize:      globalCfg.DeleteBatchSize,
+		IdempotencyRetention: globalCfg.IdempotencyRetention * time.Second,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	httpServer, err := httpv1.New(&httpv1.Config{
-		Version:      globalCfg.HTTPApiVersion,
-		Port:         globalCfg.HTTPPort,
-		Sha:          "",
-		EventService: eventService,
+	keyService, err := services.NewAPIKeyService(&services.APIKeyServiceConfig{
+		DB:       db,
+		CacheTTL: globalCfg.APIKeyCacheTTL * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	healthService, err := services.NewHealthService(&services.HealthServiceConfig{
+		DB:          db,
+		Broadcaster: broadcaster,
+		Statsd:      statsdCfg,
+		Timeout:     globalCfg.ReadinessTimeout * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitOverrides, err := services.ParseRateLimitOverrides(globalCfg.RateLimitAppOverrides)
+	if err != nil {
+		return nil, err
+	}
+	rateLimiter, err := services.NewRateLimitService(&services.RateLimitServiceConfig{
+		MetricService:        metricService,
+		Application:          services.RateLimit{Rate: float64(globalCfg.RateLimitAppRate), Burst: globalCfg.RateLimitAppBurst},
+		APIKey:               services.RateLimit{Rate: float64(globalCfg.RateLimitKeyRate), Burst: globalCfg.RateLimitKeyBurst},
+		IP:                   services.RateLimit{Rate: float64(globalCfg.RateLimitIPRate), Burst: globalCfg.RateLimitIPBurst},
+		ApplicationOverrides: rateLimitOverrides,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientCertApps, err := middleware.ParseClientCertApplications(globalCfg.TLSClientApplications)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkClientCertConfig(globalCfg, clientCertApps); err != nil {
+		return nil, err
+	}
+
+	ingestControl := services.NewIngestControl()
+
+	if err = checkTLSConfig(globalCfg); err != nil {
+		return nil, err
+	}
+	// The http and gRPC servers share a certificate
+	tlsCfg := &apihttp.TLSConfig{
+		CertFile:       globalCfg.TLSCertFile,
+		KeyFile:        globalCfg.TLSKeyFile,
+		ClientCAFile:   globalCfg.TLSClientCAFile,
+		ClientAuth:     globalCfg.TLSClientAuth,
+		ReloadInterval: globalCfg.TLSReloadInterval * time.Second,
+	}
+	httpServer, err := apihttp.New(&apihttp.Config{
+		Port: globalCfg.HTTPPort,
+		TLS:  tlsCfg,
 	})
 	if err != nil {
 		return nil, err
 	}
+	// Open event streams are ended on shutdown, so they don't hold it up
+	httpServer.RegisterOnShutdown(broadcaster.Close)
+
+	versionOpts, err := apihttp.ParseVersionOptions(globalCfg.HTTPDeprecatedVersions, globalCfg.HTTPSunsetVersions)
+	if err != nil {
+		return nil, err
+	}
+	apiCfg := &httpv1.Config{
+		Sha:           Sha,
+		AppVersion:    Version,
+		EventService:  eventService,
+		Broadcaster:   broadcaster,
+		StatsClient:   statsd,
+		MetricService: metricService,
+		Prometheus:    prometheus,
+		KeyService:    keyService,
+		Health:        healthService,
+
+		MaxBodySize:             globalCfg.MaxBodySize,
+		MaxDecompressedBodySize: globalCfg.MaxDecompressedBodySize,
+		RequireAPIKeys:          globalCfg.RequireAPIKeys,
+		ClientCertApplications:  clientCertApps,
+		RateLimiter:             rateLimiter,
+		IngestControl:           ingestControl,
+	}
+	for _, v := range apiVersions(globalCfg.HTTPApiVersions, "HTTP_API_VERSIONS", globalCfg.HTTPApiVersion, "HTTP_API_VERSION") {
+		api, err := httpVersions.New(v, apiCfg)
+		if err != nil {
+			return nil, err
+		}
+		if err = httpServer.Register(api, versionOpts[api.Version()]); err != nil {
+			return nil, err
+		}
+	}
+
+	var pbServer *apipb.Server
+	if globalCfg.PBEnabled {
+		pbServer, err = apipb.New(&apipb.Config{
+			Port:           globalCfg.PBPort,
+			TLS:            tlsCfg,
+			MaxMessageSize: int(globalCfg.MaxBodySize),
+		})
+		if err != nil {
+			return nil, err
+		}
+		pbCfg := &pbv1.Config{
+			EventService:           eventService,
+			MetricService:          metricService,
+			KeyService:             keyService,
+			RequireAPIKeys:         globalCfg.RequireAPIKeys,
+			ClientCertApplications: clientCertApps,
+			RateLimiter:            rateLimiter,
+			IngestControl:          ingestControl,
+			IngestBatchSize:        globalCfg.PBIngestBatchSize,
+			IngestBufferSize:       globalCfg.PBIngestBufferSize,
+		}
+		for _, v := range apiVersions(globalCfg.PBApiVersions, "PB_API_VERSIONS", globalCfg.PBApiVersion, "PB_API_VERSION") {
+			api, err := pbVersions.New(v, pbCfg)
+			if err != nil {
+				return nil, err
+			}
+			if err = pbServer.Register(api); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var adminServer *admin.Server
+	if prometheus != nil && !globalCfg.AdminEnabled {
+		logging.Warnf("Prometheus metrics are enabled, but the admin listener they are served from is not")
+	}
+	if globalCfg.AdminEnabled {
+		adminServer, err = admin.New(&admin.Config{
+			Address:       globalCfg.AdminAddress,
+			Config:        globalCfg,
+			IngestControl: ingestControl,
+			Metrics:       adminMetrics(prometheus),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Payload{
 		EventService:  eventService,
 		MetricService: metricService,
+		Broadcaster:   broadcaster,
+		KeyService:    keyService,
+		IngestControl: ingestControl,
 		HTTPServer:    httpServer,
+		PBServer:      pbServer,
+		AdminServer:   adminServer,
+		Statsd:        statsd,
+		DB:            db,
+		Config:        globalCfg,
 	}, nil
 }
 
+// Shutdown will stop the http and gRPC servers, waiting for in flight requests until
+// ctx is done, and then flush and close the system's dependencies. Every step is
+// attempted even if an earlier one fails, and the first error is returned
+func (p *Payload) Shutdown(ctx context.Context) error {
+	var firstErr error
+	record := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if p.HTTPServer != nil {
+		record(p.HTTPServer.Shutdown(ctx))
+	}
+	if p.PBServer != nil {
+		record(p.PBServer.Shutdown(ctx))
+	}
+	if p.AdminServer != nil {
+		record(p.AdminServer.Shutdown(ctx))
+	}
+	if p.Statsd != nil {
+		record(p.Statsd.Close())
+	}
+	// Background work against the database has to finish before it is closed
+	if p.EventService != nil {
+		p.EventService.Close()
+	}
+	if p.DB != nil {
+		record(p.DB.Close())
+	}
+	return firstErr
+}
+
+// adminMetrics is the handler the admin server serves metrics with, nil when
+// Prometheus is disabled
+func adminMetrics(p *services.PrometheusMetrics) http.Handler {
+	if p == nil {
+		return nil
+	}
+	return p.Handler()
+}
+
+// checkClientCertConfig refuses to map client certificates to applications when
+// nothing else identifies callers, unless every connection must present one.
+// Otherwise clients could leave their certificate out and be refused every
+// request, which is never what was meant
+func checkClientCertConfig(cfg *config.Config, apps map[string][]string) error {
+	if len(apps) == 0 || cfg.RequireAPIKeys || cfg.TLSClientAuth == apihttp.ClientAuthRequire {
+		return nil
+	}
+	return fmt.Errorf("TLS_CLIENT_APPLICATIONS needs TLS_CLIENT_AUTH=%s when API keys are not required, not %q", apihttp.ClientAuthRequire, cfg.TLSClientAuth)
+}
+
+// checkTLSConfig refuses a certificate without its key, or a key without its
+// certificate, rather than quietly serving plaintext
+func checkTLSConfig(cfg *config.Config) error {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together, or not at all")
+	}
+	return nil
+}
+
+// apiVersions lists the versions in the setting named key, falling back to the
+// deprecated single version setting named oldKey, and then to version 1, so that
+// deployments still setting oldKey keep serving the version they asked for
+func apiVersions(versions, key, old, oldKey string) []string {
+	if versions != "" {
+		if old != "" {
+			logging.Warnf("%s is deprecated, and ignored as %s is set", oldKey, key)
+		}
+		return splitList(versions)
+	}
+	if old != "" {
+		logging.Warnf("%s is deprecated, use %s instead", oldKey, key)
+		return []string{old}
+	}
+	return []string{"1"}
+}
+
+// splitList breaks a comma separated config value into its trimmed, non-empty parts
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
 func openDB(cfg *config.Config) (*sqlx.DB, error) {
 	return sqlx.Open("postgres", cfg.DBConnString)
 }
@@ -0,0 +1,141 @@
+package boot
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/StabbyCutyou/blunderbuss/config"
+	"github.com/StabbyCutyou/blunderbuss/services"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestCheckClientCertConfig(t *testing.T) {
+	mapping := map[string][]string{"billing-svc": {"billing"}}
+	tests := []struct {
+		name        string
+		apps        map[string][]string
+		requireKeys bool
+		clientAuth  string
+		wantErr     bool
+	}{
+		{name: "no mapping", clientAuth: "optional"},
+		{name: "mapping with keys", apps: mapping, requireKeys: true, clientAuth: "optional"},
+		{name: "mapping with required certificates", apps: mapping, clientAuth: "require"},
+		{name: "mapping with optional certificates", apps: mapping, clientAuth: "optional", wantErr: true},
+		{name: "mapping without certificates", apps: mapping, clientAuth: "none", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{RequireAPIKeys: tt.requireKeys, TLSClientAuth: tt.clientAuth}
+			if err := checkClientCertConfig(cfg, tt.apps); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckTLSConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		wantErr  bool
+	}{
+		{name: "plaintext"},
+		{name: "certificate and key", certFile: "cert.pem", keyFile: "key.pem"},
+		{name: "certificate without a key", certFile: "cert.pem", wantErr: true},
+		{name: "key without a certificate", keyFile: "key.pem", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{TLSCertFile: tt.certFile, TLSKeyFile: tt.keyFile}
+			if err := checkTLSConfig(cfg); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions string
+		old      string
+		want     []string
+	}{
+		{name: "nothing set", want: []string{"1"}},
+		{name: "versions", versions: "1, 2", want: []string{"1", "2"}},
+		{name: "deprecated version", old: "2", want: []string{"2"}},
+		{name: "versions win over the deprecated version", versions: "2", old: "1", want: []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := apiVersions(tt.versions, "HTTP_API_VERSIONS", tt.old, "HTTP_API_VERSION")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// fakeStatsd records that it was closed, and fails to close with err
+type fakeStatsd struct {
+	services.StatsdClient
+	closed bool
+	err    error
+}
+
+func (f *fakeStatsd) Close() error {
+	f.closed = true
+	return f.err
+}
+
+// fakeEventService uses the database as it closes, as a service finishing
+// background work would
+type fakeEventService struct {
+	services.IEventLoggingService
+	db      *sqlx.DB
+	pingErr error
+}
+
+func (f *fakeEventService) Close() {
+	f.pingErr = f.db.Ping()
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		statsErr error
+	}{
+		{name: "clean"},
+		// A failing step doesn't stop the rest from running
+		{name: "statsd failing", statsErr: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The event service must be finished with the database before it closes
+			mock.ExpectPing()
+			mock.ExpectClose()
+
+			stats := &fakeStatsd{err: tt.statsErr}
+			es := &fakeEventService{db: sqlx.NewDb(db, "postgres")}
+			p := &Payload{Statsd: stats, EventService: es, DB: es.db}
+			if err = p.Shutdown(context.Background()); err != tt.statsErr {
+				t.Fatalf("expected error %v, got %v", tt.statsErr, err)
+			}
+			if !stats.closed || es.pingErr != nil {
+				t.Fatalf("expected statsd to be flushed and the service closed first, got %v and %v", stats.closed, es.pingErr)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package boot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	apihttp "github.com/StabbyCutyou/blunderbuss/api/http"
+	"github.com/StabbyCutyou/blunderbuss/api/http/v1"
+	"github.com/StabbyCutyou/blunderbuss/api/http/v2"
+	apipb "github.com/StabbyCutyou/blunderbuss/api/pb"
+	"github.com/StabbyCutyou/blunderbuss/api/pb/v1"
+)
+
+// versionRegistry holds the constructor for each version of an api, so that a new
+// version only needs registering to become servable
+type versionRegistry[C any, A any] struct {
+	name  string
+	ctors map[int]func(C) (A, error)
+}
+
+var (
+	httpVersions = &versionRegistry[*httpv1.Config, apihttp.API]{name: "HTTP"}
+	pbVersions   = &versionRegistry[*pbv1.Config, apipb.API]{name: "protobuf"}
+)
+
+func init() {
+	httpVersions.Register(1, func(cfg *httpv1.Config) (apihttp.API, error) { return httpv1.New(cfg) })
+	httpVersions.Register(2, func(cfg *httpv1.Config) (apihttp.API, error) { return httpv2.New(cfg) })
+	pbVersions.Register(1, func(cfg *pbv1.Config) (apipb.API, error) { return pbv1.New(cfg) })
+}
+
+// Register adds the constructor for version v. Registering a version twice is a
+// programming error, and panics
+func (r *versionRegistry[C, A]) Register(v int, ctor func(C) (A, error)) {
+	if r.ctors == nil {
+		r.ctors = make(map[int]func(C) (A, error))
+	}
+	if _, ok := r.ctors[v]; ok {
+		panic(fmt.Sprintf("%s api version %d is already registered", r.name, v))
+	}
+	r.ctors[v] = ctor
+}
+
+// New builds the given version, which may be written as "2" or "v2"
+func (r *versionRegistry[C, A]) New(version string, cfg C) (A, error) {
+	var api A
+	v, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return api, fmt.Errorf("Invalid %s api version %q", r.name, version)
+	}
+	ctor, ok := r.ctors[v]
+	if !ok {
+		return api, fmt.Errorf("Unknown %s api version %d, expected one of %v", r.name, v, r.Versions())
+	}
+	return ctor(cfg)
+}
+
+// Versions lists the registered versions, in ascending order
+func (r *versionRegistry[C, A]) Versions() []int {
+	versions := make([]int, 0, len(r.ctors))
+	for v := range r.ctors {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
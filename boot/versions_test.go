@@ -0,0 +1,52 @@
+package boot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVersionRegistry(t *testing.T) {
+	r := &versionRegistry[string, string]{name: "test"}
+	r.Register(1, func(cfg string) (string, error) { return "one:" + cfg, nil })
+	r.Register(3, func(cfg string) (string, error) { return "", errors.New("broken") })
+
+	tests := []struct {
+		name    string
+		version string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain number", version: "1", want: "one:cfg"},
+		{name: "with a v", version: "v1", want: "one:cfg"},
+		{name: "not a number", version: "latest", wantErr: true},
+		{name: "unknown", version: "2", wantErr: true},
+		{name: "constructor fails", version: "3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.New(tt.version, "cfg")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("expected %q and error %v, got %q and %v", tt.want, tt.wantErr, got, err)
+			}
+		})
+	}
+
+	if got := r.Versions(); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Fatalf("expected versions [1 3], got %v", got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected registering version 1 twice to panic")
+		}
+	}()
+	r.Register(1, nil)
+}
+
+func TestVersionsRegistered(t *testing.T) {
+	if got := httpVersions.Versions(); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("expected http versions [1 2], got %v", got)
+	}
+	if got := pbVersions.Versions(); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("expected protobuf versions [1], got %v", got)
+	}
+}
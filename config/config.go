@@ -8,15 +8,105 @@ import "time"
 // Config is a collection of configuration variables and pointers to dependencies.
 type Config struct {
 	HTTPPort int `env:"HTTP_PORT" default:"1234"`
-	// TODO this needs to pivot to be multiple versions
-	HTTPApiVersion int `env:"HTTP_API_VERSION" default:"1"`
+	// HTTPApiVersions is a comma separated list of the http api versions to serve,
+	// 1 when it is not set. HTTPApiVersion is the single version served before it,
+	// which is deprecated and only read when HTTPApiVersions is not set
+	HTTPApiVersions string `env:"HTTP_API_VERSIONS" optional:"true"`
+	HTTPApiVersion  string `env:"HTTP_API_VERSION" optional:"true"`
+	// HTTPDeprecatedVersions marks versions as deprecated, optionally from a date,
+	// in the form "1=2026-10-01,2". HTTPSunsetVersions gives the date a version
+	// will be removed, in the form "1=2027-06-30"
+	HTTPDeprecatedVersions string `env:"HTTP_DEPRECATED_VERSIONS" optional:"true"`
+	HTTPSunsetVersions     string `env:"HTTP_SUNSET_VERSIONS" optional:"true"`
 
-	PBPort int `env:"PB_PORT" default:"1234"`
-	// TODO this needs to pivot to be multiple versions
-	PBApiVersion int    `env:"PB_API_VERSION" default:"1"`
-	DBConnString string `env:"DB_CONN_STRING"`
+	// PBEnabled serves the protobuf api over gRPC, on a port of its own
+	PBEnabled bool `env:"PB_ENABLED" default:"true"`
+	PBPort    int  `env:"PB_PORT" default:"1235"`
+	// PBApiVersions is a comma separated list of the protobuf api versions to serve,
+	// 1 when it is not set. PBApiVersion is deprecated, as HTTPApiVersion is
+	PBApiVersions string `env:"PB_API_VERSIONS" optional:"true"`
+	PBApiVersion  string `env:"PB_API_VERSION" optional:"true"`
+	// PBIngestBatchSize is the most events a gRPC ingest stream stores at once, and
+	// PBIngestBufferSize how many it reads ahead of storing before pushing back
+	PBIngestBatchSize  int `env:"PB_INGEST_BATCH_SIZE" default:"500"`
+	PBIngestBufferSize int `env:"PB_INGEST_BUFFER_SIZE" default:"5000"`
 
+	DBConnString string `env:"DB_CONN_STRING" secret:"true"`
+
+	// AdminAddress is where the operator endpoints, such as pprof, are served. It
+	// is loopback only by default, and should never be reachable publicly
+	AdminEnabled bool   `env:"ADMIN_ENABLED" default:"true"`
+	AdminAddress string `env:"ADMIN_ADDRESS" default:"127.0.0.1:1236"`
+	// LogLevel is one of debug, info, warn or error. It can be changed while running
+	// through the admin endpoints
+	LogLevel string `env:"LOG_LEVEL" default:"info"`
+
+	StatsdEnabled  bool          `env:"STATSD_ENABLED" default:"false"`
 	StatsdPrefix   string        `env:"STATSD_PREFIX" default:"xxx"`
 	StatsdAddress  string        `env:"STATD_ADDRESS" default:"127.0.0.1"`
 	StatsdInterval time.Duration `env:"STATSD_INTERVAL" default:"10"`
+	// StatsdMaxApplications caps how many applications, and how many API keys, get
+	// stats named after them, the rest are counted together as other
+	StatsdMaxApplications int `env:"STATSD_MAX_APPLICATIONS" default:"100"`
+
+	// PrometheusEnabled serves metrics about blunderbuss itself at /metrics, on the
+	// admin listener. PrometheusMaxApplications caps how many applications are
+	// labelled by name, the rest are counted together as other
+	PrometheusEnabled         bool `env:"PROMETHEUS_ENABLED" default:"true"`
+	PrometheusMaxApplications int  `env:"PROMETHEUS_MAX_APPLICATIONS" default:"100"`
+
+	StreamBufferSize int `env:"STREAM_BUFFER_SIZE" default:"256"`
+
+	MaxBodySize             int64 `env:"MAX_BODY_SIZE" default:"5242880"`
+	MaxDecompressedBodySize int64 `env:"MAX_DECOMPRESSED_BODY_SIZE" default:"10485760"`
+
+	// Limits on individual events, a limit of 0 disables it. Events with an oversized
+	// application or type are rejected, other oversized fields are truncated. Array
+	// elements count towards MaxContextKeys, as object keys do
+	MaxApplicationLength int `env:"MAX_APPLICATION_LENGTH" default:"256"`
+	MaxTypeLength        int `env:"MAX_TYPE_LENGTH" default:"256"`
+	MaxMessageLength     int `env:"MAX_MESSAGE_LENGTH" default:"4096"`
+	MaxStackTraceLength  int `env:"MAX_STACK_TRACE_LENGTH" default:"65536"`
+	MaxContextDepth      int `env:"MAX_CONTEXT_DEPTH" default:"10"`
+	MaxContextKeys       int `env:"MAX_CONTEXT_KEYS" default:"500"`
+	// RequiredEventFields is a comma separated list of fields events must have
+	RequiredEventFields string `env:"REQUIRED_EVENT_FIELDS" default:"application,type"`
+
+	// IdempotencyRetention is how many seconds idempotency keys are remembered for.
+	// 0 turns off deduplication
+	IdempotencyRetention time.Duration `env:"IDEMPOTENCY_RETENTION" default:"86400"`
+
+	// DeleteBatchSize is how many events are removed per statement when purging
+	DeleteBatchSize int `env:"DELETE_BATCH_SIZE" default:"5000"`
+
+	RequireAPIKeys bool          `env:"REQUIRE_API_KEYS" default:"true"`
+	APIKeyCacheTTL time.Duration `env:"API_KEY_CACHE_TTL" default:"30"`
+
+	// ShutdownTimeout is how many seconds in flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30"`
+	// ReadinessTimeout is how many seconds each readiness check may take
+	ReadinessTimeout time.Duration `env:"READINESS_TIMEOUT" default:"2"`
+
+	// TLSCertFile and TLSKeyFile turn on TLS, and must be set together
+	TLSCertFile string `env:"TLS_CERT_FILE" optional:"true"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE" optional:"true"`
+	// TLSClientAuth is one of none, optional or require
+	TLSClientAuth string `env:"TLS_CLIENT_AUTH" default:"none"`
+	// TLSClientCAFile is only read at startup, unlike the certificate and key
+	TLSClientCAFile string `env:"TLS_CLIENT_CA_FILE" optional:"true"`
+	// TLSClientApplications maps client certificate names to applications, in the
+	// form "name=app1|app2,othername=app3"
+	TLSClientApplications string        `env:"TLS_CLIENT_APPLICATIONS" optional:"true"`
+	TLSReloadInterval     time.Duration `env:"TLS_RELOAD_INTERVAL" default:"10"`
+
+	// Rate limits are in events per second, a rate of 0 disables the limit
+	RateLimitAppRate  float32 `env:"RATE_LIMIT_APP_RATE" default:"0"`
+	RateLimitAppBurst int     `env:"RATE_LIMIT_APP_BURST" default:"0"`
+	RateLimitKeyRate  float32 `env:"RATE_LIMIT_KEY_RATE" default:"0"`
+	RateLimitKeyBurst int     `env:"RATE_LIMIT_KEY_BURST" default:"0"`
+	RateLimitIPRate   float32 `env:"RATE_LIMIT_IP_RATE" default:"0"`
+	RateLimitIPBurst  int     `env:"RATE_LIMIT_IP_BURST" default:"0"`
+	// RateLimitAppOverrides set limits for specific applications, in the form
+	// "app=rate:burst,otherapp=rate:burst"
+	RateLimitAppOverrides string `env:"RATE_LIMIT_APP_OVERRIDES" optional:"true"`
 }
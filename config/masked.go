@@ -0,0 +1,35 @@
+package config
+
+import (
+	"reflect"
+	"time"
+)
+
+// maskedValue replaces the value of secret fields when the config is displayed
+const maskedValue = "********"
+
+// Masked returns the config keyed by environment variable, for display. Fields
+// tagged with secret:"true" have their values replaced, unless they are empty
+func (c *Config) Masked() map[string]interface{} {
+	out := make(map[string]interface{})
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		fv := v.Field(i)
+		switch {
+		case f.Tag.Get("secret") == "true" && !fv.IsZero():
+			out[name] = maskedValue
+		case fv.Type() == reflect.TypeOf(time.Duration(0)):
+			// Durations are configured as plain numbers, so show them the same way
+			out[name] = fv.Int()
+		default:
+			out[name] = fv.Interface()
+		}
+	}
+	return out
+}
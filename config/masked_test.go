@@ -0,0 +1,20 @@
+package config
+
+import "testing"
+
+func TestMasked(t *testing.T) {
+	c := &Config{DBConnString: "postgres://blunderbuss:hunter2@db/blunderbuss", ShutdownTimeout: 30}
+	m := c.Masked()
+	if m["DB_CONN_STRING"] != maskedValue {
+		t.Fatalf("expected the connection string to be masked, got %v", m["DB_CONN_STRING"])
+	}
+	// Durations hold a count of seconds, and are shown as they are configured
+	if m["SHUTDOWN_TIMEOUT"] != int64(30) {
+		t.Fatalf("expected the shutdown timeout as a number, got %v", m["SHUTDOWN_TIMEOUT"])
+	}
+
+	// An empty secret is shown as empty, so a missing setting is easy to spot
+	if m = (&Config{}).Masked(); m["DB_CONN_STRING"] != "" {
+		t.Fatalf("expected an empty connection string, got %v", m["DB_CONN_STRING"])
+	}
+}
@@ -0,0 +1,91 @@
+// Package logging wraps the standard logger with levels, so that the amount of
+// logging can be turned up or down while blunderbuss is running
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is how severe a log line is. Lines below the current level are dropped
+type Level int32
+
+const (
+	// LevelDebug is for detail only useful while investigating a problem
+	LevelDebug Level = iota
+	// LevelInfo is for the normal running of the service, such as access logs
+	LevelInfo
+	// LevelWarn is for problems we recovered from
+	LevelWarn
+	// LevelError is for failures
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name of the level, as accepted by ParseLevel
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("Log level must be one of %s", strings.Join(levelNames, ", "))
+}
+
+var current = int32(LevelInfo)
+
+// SetLevel changes the level below which lines are dropped. It is safe to call
+// while other goroutines are logging
+func SetLevel(l Level) {
+	atomic.StoreInt32(&current, int32(l))
+}
+
+// CurrentLevel returns the level below which lines are dropped
+func CurrentLevel() Level {
+	return Level(atomic.LoadInt32(&current))
+}
+
+// Enabled reports whether lines at l are being written
+func Enabled(l Level) bool {
+	return l >= CurrentLevel()
+}
+
+func output(l Level, format string, args ...interface{}) {
+	if !Enabled(l) {
+		return
+	}
+	// Skip output and the exported func, so the standard logger's file flags
+	// point at the caller
+	log.Output(3, "level="+l.String()+" "+fmt.Sprintf(format, args...))
+}
+
+// Debugf logs at LevelDebug
+func Debugf(format string, args ...interface{}) {
+	output(LevelDebug, format, args...)
+}
+
+// Infof logs at LevelInfo
+func Infof(format string, args ...interface{}) {
+	output(LevelInfo, format, args...)
+}
+
+// Warnf logs at LevelWarn
+func Warnf(format string, args ...interface{}) {
+	output(LevelWarn, format, args...)
+}
+
+// Errorf logs at LevelError
+func Errorf(format string, args ...interface{}) {
+	output(LevelError, format, args...)
+}
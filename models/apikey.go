@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// ScopeIngest keys may only write events
+	ScopeIngest = "ingest"
+	// ScopeReadWrite keys may write and query events
+	ScopeReadWrite = "read_write"
+	// ScopeAdmin keys may write, query and delete events
+	ScopeAdmin = "admin"
+	// ScopePublic keys are embedded in web pages, and may only write events
+	// through the browser endpoint from one of the project's allowed origins
+	ScopePublic = "public"
+)
+
+// Project groups the applications a team owns, and the keys used to access them
+type Project struct {
+	ID           string         `db:"id" json:"id"`
+	Name         string         `db:"name" json:"name"`
+	Applications pq.StringArray `db:"applications" json:"applications"`
+	// AllowedOrigins are the web origins public keys for this project may be used from
+	AllowedOrigins pq.StringArray `db:"allowed_origins" json:"allowed_origins"`
+	CreatedAt      time.Time      `db:"created_at" json:"created_at"`
+}
+
+// APIKey grants access to the events of a set of applications. Only a hash of
+// the key itself is ever stored
+type APIKey struct {
+	ID           string         `db:"id" json:"id"`
+	ProjectID    string         `db:"project_id" json:"project_id"`
+	KeyHash      string         `db:"key_hash" json:"-"`
+	Scope        string         `db:"scope" json:"scope"`
+	Applications pq.StringArray `db:"applications" json:"applications"`
+	CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+	RevokedAt    *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+	// AllowedOrigins is loaded from the key's project
+	AllowedOrigins pq.StringArray `db:"allowed_origins" json:"-"`
+}
+
+// AllowsApplication reports whether the key may access events for app
+func (k *APIKey) AllowsApplication(app string) bool {
+	for _, a := range k.Applications {
+		if a == app {
+			return true
+		}
+	}
+	return false
+}
+
+// CanIngest reports whether the key may write events through the regular endpoints
+func (k *APIKey) CanIngest() bool {
+	return k.Scope == ScopeIngest || k.Scope == ScopeReadWrite || k.Scope == ScopeAdmin
+}
+
+// AllowsOrigin reports whether the key may be used from a web page on origin
+func (k *APIKey) AllowsOrigin(origin string) bool {
+	for _, o := range k.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead reports whether the key may query events
+func (k *APIKey) CanRead() bool {
+	return k.Scope == ScopeReadWrite || k.Scope == ScopeAdmin
+}
+
+// CanDelete reports whether the key may delete events
+func (k *APIKey) CanDelete() bool {
+	return k.Scope == ScopeAdmin
+}
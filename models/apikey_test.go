@@ -0,0 +1,53 @@
+package models
+
+import "testing"
+
+func TestAPIKeyScopes(t *testing.T) {
+	tests := []struct {
+		scope      string
+		wantIngest bool
+		wantRead   bool
+		wantDelete bool
+	}{
+		{scope: ScopeIngest, wantIngest: true},
+		{scope: ScopeReadWrite, wantIngest: true, wantRead: true},
+		{scope: ScopeAdmin, wantIngest: true, wantRead: true, wantDelete: true},
+		// Public keys only write through the browser endpoint
+		{scope: ScopePublic},
+		{scope: "superuser"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			k := &APIKey{Scope: tt.scope}
+			if k.CanIngest() != tt.wantIngest || k.CanRead() != tt.wantRead || k.CanDelete() != tt.wantDelete {
+				t.Fatalf("expected ingest %v, read %v and delete %v, got %v, %v and %v", tt.wantIngest, tt.wantRead, tt.wantDelete, k.CanIngest(), k.CanRead(), k.CanDelete())
+			}
+		})
+	}
+}
+
+func TestAPIKeyAllows(t *testing.T) {
+	k := &APIKey{Applications: []string{"billing", "search"}, AllowedOrigins: []string{"https://shop.example.com"}}
+	wildcard := &APIKey{AllowedOrigins: []string{"*"}}
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{name: "listed application", got: k.AllowsApplication("billing"), want: true},
+		{name: "unlisted application", got: k.AllowsApplication("checkout")},
+		{name: "empty application", got: k.AllowsApplication("")},
+		{name: "listed origin", got: k.AllowsOrigin("https://shop.example.com"), want: true},
+		{name: "origin differing by scheme", got: k.AllowsOrigin("http://shop.example.com")},
+		{name: "no origin", got: k.AllowsOrigin("")},
+		{name: "wildcard origin", got: wildcard.AllowsOrigin("https://anywhere.example.com"), want: true},
+		{name: "no origins allowed", got: (&APIKey{}).AllowsOrigin("https://shop.example.com")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, tt.got)
+			}
+		})
+	}
+}
@@ -5,25 +5,38 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
 )
 
 // Event is an instance of a thing that happened
 type Event struct {
+	ID          string         `db:"id"`
 	Application string         `db:"application"`
 	Type        string         `db:"type"`
 	Message     string         `db:"message"`
 	Context     types.JSONText `db:"context"`
 	StackTrace  string         `db:"stack_trace"`
 	CreatedAt   time.Time      `db:"created_at"`
+	// Truncated lists the fields that were cut short to fit within our limits
+	Truncated pq.StringArray `db:"truncated_fields"`
+	// IdempotencyKey is optional. An event logged again with the same key for the
+	// same application, within the retention window, is not stored a second time
+	IdempotencyKey string `db:"-"`
+	// Replayed is set when logging the event found it had already been logged under
+	// its IdempotencyKey. ID is then the id of the event logged the first time
+	Replayed bool `db:"-"`
 }
 
 type eventScaffold struct {
+	ID          string                 `json:"id,omitempty"`
 	Application string                 `json:"application"`
 	Type        string                 `json:"type"`
 	Message     string                 `json:"message"`
 	Context     map[string]interface{} `json:"context"`
 	StackTrace  string                 `json:"stack_trace"`
 	CreatedAt   int64                  `json:"created_at"`
+	Truncated   []string               `json:"truncated_fields,omitempty"`
+	EventID     string                 `json:"event_id,omitempty"`
 }
 
 // UnmarshalJSON is a custom unmarshaller
@@ -36,12 +49,14 @@ func (e *Event) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+	e.ID = es.ID
 	e.Application = es.Application
 	e.Type = es.Type
 	e.Message = es.Message
 	e.Context = ctxt
 	e.StackTrace = es.StackTrace
 	e.CreatedAt = time.Unix(es.CreatedAt, 0) // no nano sec at this time
+	e.IdempotencyKey = es.EventID
 	return nil
 }
 
@@ -52,12 +67,14 @@ func (e *Event) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 	es := eventScaffold{
+		ID:          e.ID,
 		Application: e.Application,
 		Type:        e.Type,
 		Message:     e.Message,
 		Context:     ctxt,
 		StackTrace:  e.StackTrace,
 		CreatedAt:   e.CreatedAt.Unix(),
+		Truncated:   e.Truncated,
 	}
 	return json.Marshal(es)
 }
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// apiKeyPrefix makes keys easy to recognise, for instance by secret scanners
+const apiKeyPrefix = "bbk_"
+
+// DefaultAPIKeyCacheTTL is used when APIKeyServiceConfig.CacheTTL is not set
+const DefaultAPIKeyCacheTTL = 30 * time.Second
+
+const insertProjectQuery = "INSERT INTO projects (id, name, applications, allowed_origins, created_at) VALUES ($1, $2, $3, $4, $5)"
+
+const setAllowedOriginsQuery = "UPDATE projects SET allowed_origins = $1 WHERE id = $2"
+
+const getProjectQuery = "SELECT * FROM projects WHERE id = $1"
+
+const insertAPIKeyQuery = "INSERT INTO api_keys (id, project_id, key_hash, scope, applications, created_at) VALUES ($1, $2, $3, $4, $5, $6)"
+
+const getAPIKeyQuery = "SELECT k.*, p.allowed_origins FROM api_keys k JOIN projects p ON p.id = k.project_id WHERE k.key_hash = $1 AND k.revoked_at IS NULL"
+
+const revokeAPIKeyQuery = "UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL"
+
+// ErrUnauthorized is returned when a request has no key, or a key we don't recognise
+var ErrUnauthorized = NewError(CodeUnauthorized, "A valid API key is required")
+
+// ErrForbidden is returned when a key is not allowed to do what was asked of it
+var ErrForbidden = NewError(CodeForbidden, "This API key is not allowed to perform that action")
+
+// ErrInvalidScope is returned when creating a key with an unknown scope
+var ErrInvalidScope = NewError(CodeValidationFailed, "Scope must be one of ingest, read_write, admin or public")
+
+// APIKeyServiceConfig is
+type APIKeyServiceConfig struct {
+	DB *sqlx.DB
+	// CacheTTL is how long a successful lookup is remembered, so that every request
+	// does not need to go to the database
+	CacheTTL time.Duration
+}
+
+// APIKeyService is
+type APIKeyService struct {
+	db       *sqlx.DB
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	key     *models.APIKey
+	expires time.Time
+}
+
+// IAPIKeyService is
+type IAPIKeyService interface {
+	Authenticate(rawKey string) (*models.APIKey, error)
+	CreateProject(name string, applications []string) (*models.Project, error)
+	CreateAPIKey(projectID string, scope string, applications []string) (string, *models.APIKey, error)
+	RevokeAPIKey(id string) error
+	SetAllowedOrigins(projectID string, origins []string) error
+}
+
+// NewAPIKeyService is
+func NewAPIKeyService(cfg *APIKeyServiceConfig) (IAPIKeyService, error) {
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultAPIKeyCacheTTL
+	}
+	return &APIKeyService{
+		db:       cfg.DB,
+		cacheTTL: ttl,
+		cache:    make(map[string]cachedAPIKey),
+	}, nil
+}
+
+// Authenticate will return the key matching rawKey, or ErrUnauthorized if there is
+// no such key or it has been revoked
+func (s *APIKeyService) Authenticate(rawKey string) (*models.APIKey, error) {
+	if rawKey == "" {
+		return nil, ErrUnauthorized
+	}
+	hash := hashAPIKey(rawKey)
+
+	s.mu.Lock()
+	c, ok := s.cache[hash]
+	s.mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.key, nil
+	}
+
+	k := &models.APIKey{}
+	if err := s.db.Get(k, getAPIKeyQuery, hash); err != nil {
+		if isNoRows(err) {
+			return nil, ErrUnauthorized
+		}
+		return nil, wrapDBError(err)
+	}
+
+	s.mu.Lock()
+	s.cache[hash] = cachedAPIKey{key: k, expires: time.Now().Add(s.cacheTTL)}
+	s.mu.Unlock()
+	return k, nil
+}
+
+// CreateProject will create a project owning the given applications
+func (s *APIKeyService) CreateProject(name string, applications []string) (*models.Project, error) {
+	if name == "" || len(applications) == 0 {
+		return nil, NewError(CodeValidationFailed, "A project needs a name and atleast one application")
+	}
+	id, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+	p := &models.Project{
+		ID:             id,
+		Name:           name,
+		Applications:   pq.StringArray(applications),
+		AllowedOrigins: pq.StringArray{},
+		CreatedAt:      time.Now().UTC(),
+	}
+	if _, err := s.db.Exec(insertProjectQuery, p.ID, p.Name, p.Applications, p.AllowedOrigins, p.CreatedAt); err != nil {
+		return nil, wrapDBError(err)
+	}
+	return p, nil
+}
+
+// CreateAPIKey will create a new key for a project, returning the raw key alongside
+// its record. The raw key can not be recovered later. If no applications are given
+// the key may access all of the project's applications, otherwise they must be a
+// subset of them
+func (s *APIKeyService) CreateAPIKey(projectID string, scope string, applications []string) (string, *models.APIKey, error) {
+	switch scope {
+	case models.ScopeIngest, models.ScopeReadWrite, models.ScopeAdmin, models.ScopePublic:
+	default:
+		return "", nil, ErrInvalidScope
+	}
+
+	p := &models.Project{}
+	if err := s.db.Get(p, getProjectQuery, projectID); err != nil {
+		if isNoRows(err) {
+			return "", nil, NewError(CodeNotFound, "Project not found")
+		}
+		return "", nil, wrapDBError(err)
+	}
+
+	if len(applications) == 0 {
+		applications = p.Applications
+	}
+	for _, app := range applications {
+		if !containsString(p.Applications, app) {
+			return "", nil, NewError(CodeValidationFailed, "Application "+app+" does not belong to project "+p.Name)
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	raw := apiKeyPrefix + hex.EncodeToString(b)
+
+	id, err := newEventID()
+	if err != nil {
+		return "", nil, err
+	}
+	k := &models.APIKey{
+		ID:           id,
+		ProjectID:    p.ID,
+		KeyHash:      hashAPIKey(raw),
+		Scope:        scope,
+		Applications: pq.StringArray(applications),
+		CreatedAt:    time.Now().UTC(),
+	}
+	if _, err := s.db.Exec(insertAPIKeyQuery, k.ID, k.ProjectID, k.KeyHash, k.Scope, k.Applications, k.CreatedAt); err != nil {
+		return "", nil, wrapDBError(err)
+	}
+	return raw, k, nil
+}
+
+// RevokeAPIKey will stop a key from being accepted. Because lookups are cached, a
+// revoked key may continue to work for up to the cache TTL on other processes
+func (s *APIKeyService) RevokeAPIKey(id string) error {
+	res, err := s.db.Exec(revokeAPIKeyQuery, time.Now().UTC(), id)
+	if err != nil {
+		return wrapDBError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return NewError(CodeNotFound, "API key not found")
+	}
+
+	s.mu.Lock()
+	for hash, c := range s.cache {
+		if c.key.ID == id {
+			delete(s.cache, hash)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// SetAllowedOrigins will replace the web origins that the project's public keys
+// may be used from. An origin of * allows any page
+func (s *APIKeyService) SetAllowedOrigins(projectID string, origins []string) error {
+	if origins == nil {
+		origins = []string{}
+	}
+	res, err := s.db.Exec(setAllowedOriginsQuery, pq.StringArray(origins), projectID)
+	if err != nil {
+		return wrapDBError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return NewError(CodeNotFound, "Project not found")
+	}
+
+	s.mu.Lock()
+	for hash, c := range s.cache {
+		if c.key.ProjectID == projectID {
+			delete(s.cache, hash)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
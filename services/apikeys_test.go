@@ -0,0 +1,160 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func newMockKeyService(t *testing.T) (*APIKeyService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := NewAPIKeyService(&APIKeyServiceConfig{DB: sqlx.NewDb(db, "postgres"), CacheTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*APIKeyService), mock
+}
+
+func TestAuthenticate(t *testing.T) {
+	const raw = "bbk_0123456789abcdef"
+	keyColumns := []string{"id", "project_id", "key_hash", "scope", "applications", "created_at", "revoked_at", "allowed_origins"}
+	keyRow := []driver.Value{"00000000-0000-4000-8000-000000000001", "00000000-0000-4000-8000-0000000000aa", hashAPIKey(raw), "ingest", "{billing}", time.Now(), nil, "{}"}
+
+	tests := []struct {
+		name     string
+		rawKey   string
+		row      []driver.Value
+		dbErr    error
+		wantCode ErrorCode
+	}{
+		{name: "no key", wantCode: CodeUnauthorized},
+		{name: "unknown or revoked key", rawKey: raw, wantCode: CodeUnauthorized},
+		{name: "database failing", rawKey: raw, dbErr: errors.New("syntax error"), wantCode: CodeInternal},
+		{name: "known key", rawKey: raw, row: keyRow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newMockKeyService(t)
+			if tt.rawKey != "" {
+				q := mock.ExpectQuery(getAPIKeyQuery).WithArgs(hashAPIKey(tt.rawKey))
+				switch {
+				case tt.dbErr != nil:
+					q.WillReturnError(tt.dbErr)
+				case tt.row != nil:
+					q.WillReturnRows(sqlmock.NewRows(keyColumns).AddRow(tt.row...))
+				default:
+					q.WillReturnRows(sqlmock.NewRows(keyColumns))
+				}
+			}
+
+			k, err := s.Authenticate(tt.rawKey)
+			if tt.wantCode != "" {
+				if ErrorCodeOf(err) != tt.wantCode {
+					t.Fatalf("expected a %s error, got %v", tt.wantCode, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if k.Scope != "ingest" || !k.AllowsApplication("billing") {
+					t.Fatalf("unexpected key %+v", k)
+				}
+				// A second lookup is answered from the cache, without a query
+				if again, err := s.Authenticate(tt.rawKey); err != nil || again != k {
+					t.Fatalf("expected the cached key, got %v and %v", again, err)
+				}
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKeyClearsCache(t *testing.T) {
+	const raw = "bbk_0123456789abcdef"
+	const id = "00000000-0000-4000-8000-000000000001"
+	keyColumns := []string{"id", "scope", "applications"}
+
+	s, mock := newMockKeyService(t)
+	mock.ExpectQuery(getAPIKeyQuery).WithArgs(hashAPIKey(raw)).WillReturnRows(sqlmock.NewRows(keyColumns).AddRow(id, "ingest", "{billing}"))
+	mock.ExpectExec(revokeAPIKeyQuery).WithArgs(sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(getAPIKeyQuery).WithArgs(hashAPIKey(raw)).WillReturnRows(sqlmock.NewRows(keyColumns))
+
+	if _, err := s.Authenticate(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeAPIKey(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(raw); err != ErrUnauthorized {
+		t.Fatalf("expected the revoked key to be refused, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	const projectID = "00000000-0000-4000-8000-0000000000aa"
+	projectColumns := []string{"id", "name", "applications", "allowed_origins", "created_at"}
+
+	tests := []struct {
+		name         string
+		scope        string
+		applications []string
+		noProject    bool
+		wantApps     []string
+		wantCode     ErrorCode
+	}{
+		{name: "defaults to the project's applications", scope: "ingest", wantApps: []string{"billing", "search"}},
+		{name: "subset of the project's applications", scope: "read_write", applications: []string{"search"}, wantApps: []string{"search"}},
+		{name: "application outside the project", scope: "admin", applications: []string{"checkout"}, wantCode: CodeValidationFailed},
+		{name: "unknown scope", scope: "superuser", wantCode: CodeValidationFailed},
+		{name: "unknown project", scope: "ingest", noProject: true, wantCode: CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newMockKeyService(t)
+			if tt.scope != "superuser" {
+				rows := sqlmock.NewRows(projectColumns)
+				if !tt.noProject {
+					rows.AddRow(projectID, "shop", "{billing,search}", "{}", time.Now())
+				}
+				mock.ExpectQuery(getProjectQuery).WithArgs(projectID).WillReturnRows(rows)
+			}
+			if tt.wantCode == "" {
+				mock.ExpectExec(insertAPIKeyQuery).
+					WithArgs(sqlmock.AnyArg(), projectID, sqlmock.AnyArg(), tt.scope, pq.StringArray(tt.wantApps), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			raw, k, err := s.CreateAPIKey(projectID, tt.scope, tt.applications)
+			if tt.wantCode != "" {
+				if ErrorCodeOf(err) != tt.wantCode {
+					t.Fatalf("expected a %s error, got %v", tt.wantCode, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				// Only the hash of the raw key is kept
+				if k.KeyHash != hashAPIKey(raw) || k.KeyHash == raw || len(raw) <= len(apiKeyPrefix) || raw[:len(apiKeyPrefix)] != apiKeyPrefix {
+					t.Fatalf("unexpected raw key %q for hash %q", raw, k.KeyHash)
+				}
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
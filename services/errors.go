@@ -0,0 +1,136 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"net"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrorCode classifies an Error so callers (like the http api) can decide how to
+// report it without inspecting the message
+type ErrorCode string
+
+const (
+	// CodeInvalidRequest means the input could not be understood
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	// CodeUnauthorized means the caller did not identify themselves
+	CodeUnauthorized ErrorCode = "unauthorized"
+	// CodeForbidden means the caller is not allowed to do what they asked
+	CodeForbidden ErrorCode = "forbidden"
+	// CodeNotFound means the requested resource does not exist
+	CodeNotFound ErrorCode = "not_found"
+	// CodeNotAcceptable means none of the response formats the caller accepts are supported
+	CodeNotAcceptable ErrorCode = "not_acceptable"
+	// CodeTooLarge means the input exceeded a size limit
+	CodeTooLarge ErrorCode = "too_large"
+	// CodeValidationFailed means the input was understood, but is not acceptable
+	CodeValidationFailed ErrorCode = "validation_failed"
+	// CodeRateLimited means the caller has exceeded a rate limit
+	CodeRateLimited ErrorCode = "rate_limited"
+	// CodeUnavailable means a dependency, such as the database, can't be reached
+	CodeUnavailable ErrorCode = "unavailable"
+	// CodeInternal means something went wrong that the caller can't fix
+	CodeInternal ErrorCode = "internal"
+)
+
+// Error is an error with a code describing what kind of failure it was. Details
+// may hold structured information about the failure, such as which fields failed
+// validation
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Details interface{}
+	Err     error
+	// RetryAfter is set on CodeRateLimited errors, to say when to try again
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error, if any
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// retryAfterSeconds rounds wait up to whole seconds, as Retry-After requires
+func retryAfterSeconds(wait time.Duration) int {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// RetryAfterSeconds is the value for a Retry-After header telling the caller to
+// wait for e.RetryAfter
+func (e *Error) RetryAfterSeconds() int {
+	return retryAfterSeconds(e.RetryAfter)
+}
+
+// NewError returns a new Error with the given code and message
+func NewError(code ErrorCode, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// WrapError returns a new Error with the given code and message, wrapping err
+func WrapError(code ErrorCode, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// ErrorCodeOf returns the code of err if it is (or wraps) an Error, and CodeInternal
+// otherwise
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
+
+// wrapDBError classifies an error returned by the database. Failures to reach the
+// database are reported as CodeUnavailable, everything else as CodeInternal
+func wrapDBError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if isConnectionError(err) {
+		return WrapError(CodeUnavailable, "Database unavailable", err)
+	}
+	return WrapError(CodeInternal, "Database error", err)
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is connection exceptions, 53 is insufficient resources and
+		// 57P03 is cannot_connect_now
+		return pqErr.Code.Class() == "08" || pqErr.Code.Class() == "53" || pqErr.Code == "57P03"
+	}
+	return false
+}
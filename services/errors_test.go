@@ -0,0 +1,45 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestWrapDBError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode ErrorCode
+	}{
+		{name: "bad connection", err: driver.ErrBadConn, wantCode: CodeUnavailable},
+		{name: "closed connection", err: sql.ErrConnDone, wantCode: CodeUnavailable},
+		{name: "unreachable", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, wantCode: CodeUnavailable},
+		{name: "connection failure", err: &pq.Error{Code: "08006"}, wantCode: CodeUnavailable},
+		{name: "too many connections", err: &pq.Error{Code: "53300"}, wantCode: CodeUnavailable},
+		{name: "starting up", err: &pq.Error{Code: "57P03"}, wantCode: CodeUnavailable},
+		{name: "syntax error", err: &pq.Error{Code: "42601"}, wantCode: CodeInternal},
+		{name: "unknown", err: errors.New("something broke"), wantCode: CodeInternal},
+		// Errors which have already been classified are left alone
+		{name: "already classified", err: fmt.Errorf("claiming keys: %w", ErrInvalidCursor), wantCode: CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapDBError(tt.err)
+			if ErrorCodeOf(err) != tt.wantCode {
+				t.Fatalf("expected %s, got %v", tt.wantCode, err)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("%v no longer wraps %v", err, tt.err)
+			}
+		})
+	}
+	if wrapDBError(nil) != nil {
+		t.Fatal("expected no error")
+	}
+}
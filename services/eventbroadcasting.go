@@ -0,0 +1,153 @@
+package services
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
+
+// EventBroadcasterConfig is
+type EventBroadcasterConfig struct {
+	// BufferSize is how many events a subscriber may fall behind by before it is dropped
+	BufferSize int
+}
+
+// EventBroadcaster fans newly logged events out to any number of in-process
+// subscribers. Publishing never blocks, a subscriber whose buffer is full is
+// dropped instead
+type EventBroadcaster struct {
+	bufferSize  int
+	mu          sync.Mutex
+	subscribers map[*EventSubscription]struct{}
+}
+
+// IEventBroadcaster is
+type IEventBroadcaster interface {
+	Publish(e *models.Event)
+	Subscribe(p *EventSearchParams) *EventSubscription
+	Unsubscribe(s *EventSubscription)
+	Close()
+	Stats() BroadcasterStats
+}
+
+// BroadcasterStats describes how much work the broadcaster is holding
+type BroadcasterStats struct {
+	Subscribers int `json:"subscribers"`
+	// QueuedEvents is the total number of events waiting in subscriber buffers
+	QueuedEvents int `json:"queued_events"`
+	BufferSize   int `json:"buffer_size"`
+}
+
+// EventSubscription receives every published event matching its filter on Events.
+// Events is closed when the subscription ends, either by calling Unsubscribe or
+// because the subscriber could not keep up, in which case Dropped returns true
+type EventSubscription struct {
+	Events  <-chan *models.Event
+	events  chan *models.Event
+	filter  EventSearchParams
+	dropped bool
+}
+
+// Dropped reports whether the subscription was ended because it fell behind. It
+// is only meaningful once Events has been closed
+func (s *EventSubscription) Dropped() bool {
+	return s.dropped
+}
+
+// NewEventBroadcaster is
+func NewEventBroadcaster(cfg *EventBroadcasterConfig) (IEventBroadcaster, error) {
+	size := cfg.BufferSize
+	if size <= 0 {
+		size = 1
+	}
+	return &EventBroadcaster{
+		bufferSize:  size,
+		subscribers: make(map[*EventSubscription]struct{}),
+	}, nil
+}
+
+// Subscribe registers a new subscriber for events matching the application, type and
+// message of p. Time ranges are ignored, as only new events are ever delivered
+func (b *EventBroadcaster) Subscribe(p *EventSearchParams) *EventSubscription {
+	c := make(chan *models.Event, b.bufferSize)
+	s := &EventSubscription{Events: c, events: c}
+	if p != nil {
+		s.filter = *p
+	}
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Unsubscribe removes the subscriber and closes its channel. It is safe to call
+// on a subscription that has already been dropped
+func (b *EventBroadcaster) Unsubscribe(s *EventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Stats will report the current number of subscribers and queued events
+func (b *EventBroadcaster) Stats() BroadcasterStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := BroadcasterStats{Subscribers: len(b.subscribers), BufferSize: b.bufferSize}
+	for s := range b.subscribers {
+		stats.QueuedEvents += len(s.events)
+	}
+	return stats
+}
+
+// Close ends every subscription, for instance when the service is shutting down
+func (b *EventBroadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Publish delivers e to every matching subscriber without blocking
+func (b *EventBroadcaster) Publish(e *models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		if !matchesEvent(&s.filter, e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			// This subscriber is too slow, cut it loose rather than hold up ingest
+			s.dropped = true
+			delete(b.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+// matchesEvent reports whether e satisfies the application, type and message filters of p
+func matchesEvent(p *EventSearchParams, e *models.Event) bool {
+	if p.Application != "" && p.Application != e.Application {
+		return false
+	}
+	if p.Applications != nil && !containsString(p.Applications, e.Application) {
+		return false
+	}
+	if p.Type != "" && p.Type != e.Type {
+		return false
+	}
+	if p.Message != "" {
+		if p.PartialMessage {
+			return strings.Contains(e.Message, p.Message)
+		}
+		return p.Message == e.Message
+	}
+	return true
+}
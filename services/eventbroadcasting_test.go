@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
+
+func TestMatchesEvent(t *testing.T) {
+	e := &models.Event{Application: "billing", Type: "error", Message: "card declined"}
+	tests := []struct {
+		name string
+		p    EventSearchParams
+		want bool
+	}{
+		{name: "no filter", want: true},
+		{name: "application", p: EventSearchParams{Application: "billing"}, want: true},
+		{name: "other application", p: EventSearchParams{Application: "search"}},
+		{name: "allowed applications", p: EventSearchParams{Applications: []string{"search", "billing"}}, want: true},
+		{name: "no allowed applications", p: EventSearchParams{Applications: []string{}}},
+		{name: "type", p: EventSearchParams{Application: "billing", Type: "error"}, want: true},
+		{name: "other type", p: EventSearchParams{Type: "deploy"}},
+		{name: "message", p: EventSearchParams{Message: "card declined"}, want: true},
+		{name: "partial message", p: EventSearchParams{Message: "declined"}},
+		{name: "partial message allowed", p: EventSearchParams{Message: "declined", PartialMessage: true}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesEvent(&tt.p, e); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEventBroadcaster(t *testing.T) {
+	ib, err := NewEventBroadcaster(&EventBroadcasterConfig{BufferSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ib.(*EventBroadcaster)
+
+	billing := b.Subscribe(&EventSearchParams{Application: "billing"})
+	slow := b.Subscribe(nil)
+	other := b.Subscribe(&EventSearchParams{Application: "search"})
+
+	// Publishing never blocks, the subscriber which can't keep up is dropped
+	events := []*models.Event{{ID: "1", Application: "billing"}, {ID: "2", Application: "billing"}, {ID: "3", Application: "deploys"}}
+	for _, e := range events {
+		b.Publish(e)
+		// Keep up with the billing subscriber
+		if e.Application == "billing" {
+			if got := <-billing.Events; got != e {
+				t.Fatalf("expected event %s, got %v", e.ID, got)
+			}
+		}
+	}
+
+	if stats := b.Stats(); stats.Subscribers != 2 || stats.QueuedEvents != 0 || stats.BufferSize != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	var got []string
+	for e := range slow.Events {
+		got = append(got, e.ID)
+	}
+	if len(got) != 2 || got[0] != "1" || got[1] != "2" || !slow.Dropped() {
+		t.Fatalf("expected the slow subscriber to get two events then be dropped, got %v, dropped %v", got, slow.Dropped())
+	}
+	// Unsubscribing after being dropped is harmless
+	b.Unsubscribe(slow)
+
+	b.Unsubscribe(other)
+	if _, ok := <-other.Events; ok || other.Dropped() {
+		t.Fatal("expected the subscription to end without being dropped")
+	}
+	b.Unsubscribe(other)
+
+	b.Close()
+	if _, ok := <-billing.Events; ok || billing.Dropped() {
+		t.Fatal("expected close to end the subscription")
+	}
+	if stats := b.Stats(); stats.Subscribers != 0 {
+		t.Fatalf("expected no subscribers, got %+v", stats)
+	}
+}
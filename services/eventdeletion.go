@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultDeleteBatchSize is how many events are deleted per statement when the
+// service is not configured with a batch size
+const DefaultDeleteBatchSize = 5000
+
+// EventDeleteParams selects the events to delete, using the same filters as a search
+type EventDeleteParams struct {
+	EventSearchParams
+	// DryRun counts the events that would be deleted, without deleting them
+	DryRun bool `json:"dry_run"`
+}
+
+// DeleteEvents will delete every event matching the filters, and return how many
+// were deleted. Events are deleted in batches, each in its own statement, so that
+// a large purge never holds locks on the events table for long. If a batch fails
+// the events deleted by earlier batches stay deleted, and their count is returned
+// along with the error. A dry run returns the count that would have been deleted
+func (els *EventLoggingService) DeleteEvents(p *EventDeleteParams) (int64, error) {
+	if p.Application == "" && p.Type == "" && p.Message == "" {
+		return 0, ErrNoSearchValues
+	}
+
+	where := searchConditions(&p.EventSearchParams)
+	if p.DryRun {
+		defer els.observeQuery("count_events", time.Now())
+		var count int64
+		err := els.db.Get(&count, "SELECT count(*) FROM events"+where.String(), where.args...)
+		return count, wrapDBError(err)
+	}
+
+	batchSize := els.deleteBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultDeleteBatchSize
+	}
+	// The idempotency keys of deleted events go with them, so that a retry isn't
+	// answered with the id of an event which no longer exists
+	query := fmt.Sprintf(`WITH deleted AS (DELETE FROM events WHERE id IN (SELECT id FROM events%s LIMIT %d) RETURNING id),
+keys AS (DELETE FROM idempotency_keys WHERE event_id IN (SELECT id FROM deleted))
+SELECT count(*) FROM deleted`, where.String(), batchSize)
+
+	defer els.observeQuery("delete_events", time.Now())
+	var deleted int64
+	for {
+		var n int64
+		if err := els.db.Get(&n, query, where.args...); err != nil {
+			return deleted, wrapDBError(err)
+		}
+		deleted += n
+		if n < int64(batchSize) {
+			return deleted, nil
+		}
+	}
+}
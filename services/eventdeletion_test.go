@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeleteEventsDryRun(t *testing.T) {
+	els, mock := newMockService(t)
+	// Only counted, nothing is deleted
+	mock.ExpectQuery("SELECT count(*) FROM events WHERE application = $1 AND type = $2").
+		WithArgs("billing", "debug").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12345))
+
+	n, err := els.DeleteEvents(&EventDeleteParams{EventSearchParams: EventSearchParams{Application: "billing", Type: "debug"}, DryRun: true})
+	if err != nil || n != 12345 {
+		t.Fatalf("expected 12345 events, got %d and %v", n, err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteEventsNeedsFilters(t *testing.T) {
+	els, mock := newMockService(t)
+	// Deleting everything by leaving the filters out is not allowed
+	for _, dryRun := range []bool{false, true} {
+		if _, err := els.DeleteEvents(&EventDeleteParams{DryRun: dryRun}); err != ErrNoSearchValues {
+			t.Fatalf("expected ErrNoSearchValues, got %v", err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
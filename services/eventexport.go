@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
+
+// MaxExportContextKeys is the most context keys ContextKeys will discover before
+// giving up. Exports that need more should name the keys they want
+const MaxExportContextKeys = 1000
+
+// ErrTooManyContextKeys is returned when the events being exported have more
+// distinct context keys than can be turned into columns
+var ErrTooManyContextKeys = NewError(CodeValidationFailed, fmt.Sprintf("Events have more than %d context keys, name the keys to export instead", MaxExportContextKeys))
+
+// contextKeysQuery walks the context of every matching event, down through nested
+// objects, collecting the dotted path of each leaf value. The search conditions
+// and limit are filled in with Sprintf
+const contextKeysQuery = `WITH RECURSIVE context_keys(path, value) AS (
+	SELECT c.key, c.value FROM events, json_each(CASE WHEN json_typeof(context) = 'object' THEN context ELSE '{}' END) AS c%s
+	UNION ALL
+	SELECT k.path || '.' || c.key, c.value FROM context_keys AS k, json_each(CASE WHEN json_typeof(k.value) = 'object' THEN k.value ELSE '{}' END) AS c
+)
+SELECT DISTINCT path FROM context_keys WHERE json_typeof(value) <> 'object' ORDER BY path LIMIT %d`
+
+// ExportEvents calls each with every event matching the search, ordered by
+// (created_at, id). Rows are read from the database as they are needed rather
+// than all at once, so an export of any size uses constant memory. Iteration stops
+// at the first error returned by each, which is returned as is
+func (els *EventLoggingService) ExportEvents(ctx context.Context, p *EventSearchParams, order string, each func(*models.Event) error) error {
+	if p.Application == "" && p.Type == "" && p.Message == "" {
+		return ErrNoSearchValues
+	}
+	order, err := parseOrder(order, OrderAsc)
+	if err != nil {
+		return err
+	}
+
+	where := searchConditions(p)
+	query := fmt.Sprintf("SELECT * FROM events%s ORDER BY created_at %s, id %s", where.String(), order, order)
+	defer els.observeQuery("export_events", time.Now())
+	rows, err := els.db.QueryxContext(ctx, query, where.args...)
+	if err != nil {
+		return wrapDBError(err)
+	}
+	defer rows.Close()
+
+	// A single event is reused for every row, each must not hold on to it
+	e := &models.Event{}
+	for rows.Next() {
+		*e = models.Event{}
+		if err := rows.StructScan(e); err != nil {
+			return wrapDBError(err)
+		}
+		if err := each(e); err != nil {
+			return err
+		}
+	}
+	return wrapDBError(rows.Err())
+}
+
+// ContextKeys returns the dotted path of every leaf value in the context of the
+// events matching the search, sorted. Nested objects are descended into, so
+// {"a": {"b": 1}} has the key a.b
+func (els *EventLoggingService) ContextKeys(ctx context.Context, p *EventSearchParams) ([]string, error) {
+	if p.Application == "" && p.Type == "" && p.Message == "" {
+		return nil, ErrNoSearchValues
+	}
+
+	where := searchConditions(p)
+	keys := make([]string, 0)
+	query := fmt.Sprintf(contextKeysQuery, where.String(), MaxExportContextKeys+1)
+	defer els.observeQuery("context_keys", time.Now())
+	if err := els.db.SelectContext(ctx, &keys, query, where.args...); err != nil {
+		return nil, wrapDBError(err)
+	}
+	if len(keys) > MaxExportContextKeys {
+		return nil, ErrTooManyContextKeys
+	}
+	return keys, nil
+}
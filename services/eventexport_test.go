@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
+
+func TestExportEvents(t *testing.T) {
+	stop := errors.New("client went away")
+	tests := []struct {
+		name     string
+		order    string
+		query    string
+		failAt   int
+		wantIDs  []string
+		wantErr  error
+		wantCode ErrorCode
+	}{
+		{name: "oldest first by default", query: "SELECT * FROM events WHERE application = $1 ORDER BY created_at asc, id asc", wantIDs: []string{"1", "2", "3"}},
+		{name: "newest first", order: "DESC", query: "SELECT * FROM events WHERE application = $1 ORDER BY created_at desc, id desc", wantIDs: []string{"1", "2", "3"}},
+		// The rows left unread are never scanned
+		{name: "stopped part way", query: "SELECT * FROM events WHERE application = $1 ORDER BY created_at asc, id asc", failAt: 2, wantIDs: []string{"1", "2"}, wantErr: stop},
+		{name: "invalid order", order: "sideways", wantCode: CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			if tt.query != "" {
+				mock.ExpectQuery(tt.query).WithArgs("billing").WillReturnRows(
+					sqlmock.NewRows([]string{"id", "application", "type"}).AddRow("1", "billing", "error").AddRow("2", "billing", "error").AddRow("3", "billing", "error"))
+			}
+
+			var ids []string
+			err := els.ExportEvents(context.Background(), &EventSearchParams{Application: "billing"}, tt.order, func(e *models.Event) error {
+				ids = append(ids, e.ID)
+				if len(ids) == tt.failAt {
+					return stop
+				}
+				return nil
+			})
+			if tt.wantCode != "" {
+				if ErrorCodeOf(err) != tt.wantCode {
+					t.Fatalf("expected a %s error, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != tt.wantErr || !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Fatalf("expected %v and error %v, got %v and %v", tt.wantIDs, tt.wantErr, ids, err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	els, _ := newMockService(t)
+	if err := els.ExportEvents(context.Background(), &EventSearchParams{}, "", nil); err != ErrNoSearchValues {
+		t.Fatalf("expected ErrNoSearchValues, got %v", err)
+	}
+}
+
+func TestContextKeys(t *testing.T) {
+	query := fmt.Sprintf(contextKeysQuery, " WHERE application = $1", MaxExportContextKeys+1)
+	tests := []struct {
+		name    string
+		keys    int
+		wantErr error
+	}{
+		{name: "within the limit", keys: MaxExportContextKeys},
+		{name: "too many", keys: MaxExportContextKeys + 1, wantErr: ErrTooManyContextKeys},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			rows := sqlmock.NewRows([]string{"path"})
+			for i := 0; i < tt.keys; i++ {
+				rows.AddRow(fmt.Sprintf("key%d", i))
+			}
+			mock.ExpectQuery(query).WithArgs("billing").WillReturnRows(rows)
+
+			keys, err := els.ContextKeys(context.Background(), &EventSearchParams{Application: "billing"})
+			if err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && len(keys) != tt.keys {
+				t.Fatalf("expected %d keys, got %d", tt.keys, len(keys))
+			}
+		})
+	}
+}
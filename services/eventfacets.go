@@ -0,0 +1,91 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// FacetApplication lists the distinct applications events were logged for
+	FacetApplication = "application"
+	// FacetType lists the distinct types of event
+	FacetType = "type"
+	// FacetMessage lists the most common messages
+	FacetMessage = "message"
+)
+
+// facetColumns maps each facet onto the column it is drawn from
+var facetColumns = map[string]string{
+	FacetApplication: "application",
+	FacetType:        "type",
+	FacetMessage:     "message",
+}
+
+// DefaultFacetLimit is how many values a facet returns when it does not ask for a number
+const DefaultFacetLimit = 100
+
+// MaxFacetLimit is the most values a facet may return
+const MaxFacetLimit = 1000
+
+// ErrInvalidFacet is returned when asked for a facet other than application, type or message
+var ErrInvalidFacet = NewError(CodeInvalidRequest, "Facet must be one of application, type or message")
+
+// FacetParams controls which values of a facet are returned
+type FacetParams struct {
+	// Prefix is optional, when set only values starting with it are returned
+	Prefix string
+	// Limit is how many values to return, the most common first
+	Limit int
+}
+
+// FacetValue is a single value of a facet, with how often and when it was seen
+type FacetValue struct {
+	Value     string    `db:"value" json:"value"`
+	Count     int64     `db:"count" json:"count"`
+	FirstSeen time.Time `db:"first_seen" json:"first_seen"`
+	LastSeen  time.Time `db:"last_seen" json:"last_seen"`
+}
+
+// facetQuery is filled in with Sprintf, with the facet's column, the search
+// conditions and the limit
+const facetQuery = "SELECT coalesce(%s, '') AS value, count(*) AS count, min(created_at) AS first_seen, max(created_at) AS last_seen FROM events%s GROUP BY 1 ORDER BY count DESC, value LIMIT %d"
+
+// EventFacets will return the distinct values of facet among the events matching
+// the search, the most common first. Unlike FindEvents the search may be empty,
+// so that every value can be discovered
+func (els *EventLoggingService) EventFacets(facet string, p *EventSearchParams, fp *FacetParams) ([]FacetValue, error) {
+	column, ok := facetColumns[facet]
+	if !ok {
+		return nil, ErrInvalidFacet
+	}
+	limit := fp.Limit
+	if limit <= 0 {
+		limit = DefaultFacetLimit
+	}
+	if limit > MaxFacetLimit {
+		limit = MaxFacetLimit
+	}
+
+	where := searchConditions(p)
+	if fp.Prefix != "" {
+		where.add(column+" LIKE %s || '%%'", escapeLike(fp.Prefix))
+	}
+
+	values := make([]FacetValue, 0)
+	query := fmt.Sprintf(facetQuery, column, where.String(), limit)
+	defer els.observeQuery("event_facets", time.Now())
+	if err := els.db.Select(&values, query, where.args...); err != nil {
+		return nil, wrapDBError(err)
+	}
+	return values, nil
+}
+
+// likeEscaper escapes the characters LIKE treats specially, using the default
+// escape character of backslash
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes s match only itself when used in a LIKE pattern
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
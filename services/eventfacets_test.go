@@ -0,0 +1,72 @@
+package services
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"checkout":    "checkout",
+		"100%":        `100\%`,
+		"user_id":     `user\_id`,
+		`C:\temp\_%x`: `C:\\temp\\\_\%x`,
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Fatalf("expected %q to be escaped as %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestEventFacets(t *testing.T) {
+	seen := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	columns := []string{"value", "count", "first_seen", "last_seen"}
+
+	tests := []struct {
+		name  string
+		facet string
+		p     EventSearchParams
+		fp    FacetParams
+		query string
+		args  []interface{}
+	}{
+		// Every application can be listed, without any search
+		{name: "every value", facet: FacetApplication, query: fmt.Sprintf(facetQuery, "application", "", DefaultFacetLimit)},
+		{name: "within a search", facet: FacetType, p: EventSearchParams{Application: "billing"}, fp: FacetParams{Limit: 5}, query: fmt.Sprintf(facetQuery, "type", " WHERE application = $1", 5), args: []interface{}{"billing"}},
+		{name: "by prefix", facet: FacetMessage, fp: FacetParams{Prefix: "50%_off"}, query: fmt.Sprintf(facetQuery, "message", " WHERE message LIKE $1 || '%'", DefaultFacetLimit), args: []interface{}{`50\%\_off`}},
+		{name: "limit capped", facet: FacetApplication, fp: FacetParams{Limit: MaxFacetLimit + 1}, query: fmt.Sprintf(facetQuery, "application", "", MaxFacetLimit)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			var args []driver.Value
+			for _, a := range tt.args {
+				args = append(args, a)
+			}
+			mock.ExpectQuery(tt.query).WithArgs(args...).WillReturnRows(sqlmock.NewRows(columns).AddRow("billing", 3, seen, seen))
+
+			values, err := els.EventFacets(tt.facet, &tt.p, &tt.fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []FacetValue{{Value: "billing", Count: 3, FirstSeen: seen, LastSeen: seen}}
+			if !reflect.DeepEqual(values, want) {
+				t.Fatalf("expected %+v, got %+v", want, values)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	els, _ := newMockService(t)
+	if _, err := els.EventFacets("stack_trace", &EventSearchParams{}, &FacetParams{}); err != ErrInvalidFacet {
+		t.Fatalf("expected ErrInvalidFacet, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultHistogramInterval is the bucket size used when a histogram does not ask for one
+const DefaultHistogramInterval = "1h"
+
+// DefaultHistogramBuckets is how many buckets a histogram covers when it is not
+// given a start time
+const DefaultHistogramBuckets = 60
+
+// MaxHistogramBuckets is the most buckets a single histogram may have
+const MaxHistogramBuckets = 5000
+
+// DefaultHistogramGroups is how many groups a grouped histogram returns when it
+// does not ask for a number
+const DefaultHistogramGroups = 10
+
+// MaxHistogramGroups is the most groups a grouped histogram may return
+const MaxHistogramGroups = 100
+
+// histogramIntervals are the bucket sizes a histogram may use
+var histogramIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// histogramGroupColumns are the columns a histogram may be grouped by
+var histogramGroupColumns = map[string]string{
+	"application": "application",
+	"type":        "type",
+	"message":     "message",
+}
+
+// ErrInvalidInterval is returned when a histogram is given an unknown bucket size
+var ErrInvalidInterval = NewError(CodeInvalidRequest, "Interval must be one of 1m, 5m, 1h or 1d")
+
+// ErrInvalidGroupBy is returned when a histogram is grouped by an unknown field
+var ErrInvalidGroupBy = NewError(CodeInvalidRequest, "Group by must be one of application, type or message")
+
+// ErrInvalidTimeRange is returned when a histogram ends before it starts
+var ErrInvalidTimeRange = NewError(CodeInvalidRequest, "End must not be before start")
+
+// ErrTooManyBuckets is returned when the time range of a histogram is too long for its interval
+var ErrTooManyBuckets = NewError(CodeValidationFailed, fmt.Sprintf("Time range covers more than %d buckets, use a larger interval", MaxHistogramBuckets))
+
+// EventHistogramParams controls how the events matching a search are counted
+type EventHistogramParams struct {
+	// Interval is the size of each bucket, one of 1m, 5m, 1h or 1d
+	Interval string
+	// GroupBy is optional, when set there is a series for each distinct application,
+	// type or message
+	GroupBy string
+	// Groups is how many series a grouped histogram returns, the largest first
+	Groups int
+}
+
+// HistogramBucket is the number of events which happened in the Interval from Start
+type HistogramBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// HistogramSeries is the counts for a single group. An ungrouped histogram has
+// one series, with no group
+type HistogramSeries struct {
+	Group   string            `json:"group,omitempty"`
+	Total   int64             `json:"total"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// EventHistogram is a count of events over time. Every series has a bucket for
+// each interval from Start to End, including those without any events
+type EventHistogram struct {
+	Interval string            `json:"interval"`
+	GroupBy  string            `json:"group_by,omitempty"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Series   []HistogramSeries `json:"series"`
+}
+
+// histogramQuery counts the matching events in each bucket, for the groups with the
+// most events. The group column, search conditions, bucket size in seconds and
+// number of groups are filled in with Sprintf
+const histogramQuery = `WITH matched AS (
+	SELECT %s AS grp, floor(extract(epoch FROM created_at) / %d)::bigint AS bucket FROM events%s
+), top_groups AS (
+	SELECT grp FROM matched GROUP BY grp ORDER BY count(*) DESC, grp LIMIT %d
+)
+SELECT grp, bucket, count(*) AS count FROM matched WHERE grp IN (SELECT grp FROM top_groups) GROUP BY grp, bucket`
+
+// histogramRow is a single row of histogramQuery
+type histogramRow struct {
+	Group  string `db:"grp"`
+	Bucket int64  `db:"bucket"`
+	Count  int64  `db:"count"`
+}
+
+// EventHistogram will count the events matching the search in buckets of the
+// given interval. Without a time range, the histogram covers the last
+// DefaultHistogramBuckets intervals
+func (els *EventLoggingService) EventHistogram(p *EventSearchParams, hp *EventHistogramParams) (*EventHistogram, error) {
+	intervalName := hp.Interval
+	if intervalName == "" {
+		intervalName = DefaultHistogramInterval
+	}
+	interval, ok := histogramIntervals[intervalName]
+	if !ok {
+		return nil, ErrInvalidInterval
+	}
+	groupColumn := "''"
+	if hp.GroupBy != "" {
+		if groupColumn, ok = histogramGroupColumns[hp.GroupBy]; !ok {
+			return nil, ErrInvalidGroupBy
+		}
+		// Events which never had the field set are grouped together
+		groupColumn = "coalesce(" + groupColumn + ", '')"
+	}
+	groups := hp.Groups
+	if groups <= 0 {
+		groups = DefaultHistogramGroups
+	}
+	if groups > MaxHistogramGroups {
+		groups = MaxHistogramGroups
+	}
+
+	// Don't alter the caller's search when filling in the time range
+	search := *p
+	if search.End.IsZero() {
+		search.End = time.Now()
+	}
+	if search.Start.IsZero() {
+		search.Start = search.End.Add(-DefaultHistogramBuckets * interval)
+	}
+	if search.End.Before(search.Start) {
+		return nil, ErrInvalidTimeRange
+	}
+
+	secs := int64(interval / time.Second)
+	first, last := search.Start.Unix()/secs, search.End.Unix()/secs
+	if last-first+1 > MaxHistogramBuckets {
+		return nil, ErrTooManyBuckets
+	}
+
+	where := searchConditions(&search)
+	var rows []histogramRow
+	query := fmt.Sprintf(histogramQuery, groupColumn, secs, where.String(), groups)
+	defer els.observeQuery("event_histogram", time.Now())
+	if err := els.db.Select(&rows, query, where.args...); err != nil {
+		return nil, wrapDBError(err)
+	}
+
+	h := &EventHistogram{
+		Interval: intervalName,
+		GroupBy:  hp.GroupBy,
+		Start:    search.Start.UTC(),
+		End:      search.End.UTC(),
+		Series:   make([]HistogramSeries, 0),
+	}
+	// Zero fill every series, so that gaps are plotted as gaps
+	series := make(map[string]*HistogramSeries)
+	for _, row := range rows {
+		s, ok := series[row.Group]
+		if !ok {
+			s = newHistogramSeries(row.Group, first, last, secs)
+			series[row.Group] = s
+		}
+		if i := row.Bucket - first; i >= 0 && i < int64(len(s.Buckets)) {
+			s.Buckets[i].Count += row.Count
+			s.Total += row.Count
+		}
+	}
+	// An ungrouped histogram always has its one series, even when nothing matched
+	if hp.GroupBy == "" && len(series) == 0 {
+		series[""] = newHistogramSeries("", first, last, secs)
+	}
+
+	for _, s := range series {
+		h.Series = append(h.Series, *s)
+	}
+	// Largest first, as the groups were chosen
+	sort.Slice(h.Series, func(i, j int) bool {
+		if h.Series[i].Total != h.Series[j].Total {
+			return h.Series[i].Total > h.Series[j].Total
+		}
+		return h.Series[i].Group < h.Series[j].Group
+	})
+	return h, nil
+}
+
+// newHistogramSeries makes a series with an empty bucket for each of the buckets
+// numbered first to last, which are secs long
+func newHistogramSeries(group string, first, last, secs int64) *HistogramSeries {
+	s := &HistogramSeries{Group: group, Buckets: make([]HistogramBucket, last-first+1)}
+	for i := range s.Buckets {
+		s.Buckets[i].Start = time.Unix((first+int64(i))*secs, 0).UTC()
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEventHistogram(t *testing.T) {
+	start := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 3, 4, 12, 30, 0, 0, time.UTC)
+	hour := start.Unix() / 3600
+	buckets := func(counts ...int64) []HistogramBucket {
+		out := make([]HistogramBucket, len(counts))
+		for i, c := range counts {
+			out[i] = HistogramBucket{Start: start.Add(time.Duration(i) * time.Hour), Count: c}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name       string
+		hp         EventHistogramParams
+		query      string
+		rows       [][]interface{}
+		wantSeries []HistogramSeries
+	}{
+		{
+			name:  "gaps are zero filled",
+			query: fmt.Sprintf(histogramQuery, "''", 3600, " WHERE application = $1 AND created_at BETWEEN $2 AND $3", DefaultHistogramGroups),
+			rows:  [][]interface{}{{"", hour, 4}, {"", hour + 2, 1}},
+			wantSeries: []HistogramSeries{
+				{Total: 5, Buckets: buckets(4, 0, 1)},
+			},
+		},
+		{
+			name:       "nothing matched",
+			query:      fmt.Sprintf(histogramQuery, "''", 3600, " WHERE application = $1 AND created_at BETWEEN $2 AND $3", DefaultHistogramGroups),
+			wantSeries: []HistogramSeries{{Buckets: buckets(0, 0, 0)}},
+		},
+		{
+			name:  "grouped, largest first",
+			hp:    EventHistogramParams{GroupBy: "type", Groups: 2},
+			query: fmt.Sprintf(histogramQuery, "coalesce(type, '')", 3600, " WHERE application = $1 AND created_at BETWEEN $2 AND $3", 2),
+			rows:  [][]interface{}{{"deploy", hour + 1, 1}, {"error", hour, 2}, {"error", hour + 1, 3}},
+			wantSeries: []HistogramSeries{
+				{Group: "error", Total: 5, Buckets: buckets(2, 3, 0)},
+				{Group: "deploy", Total: 1, Buckets: buckets(0, 1, 0)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			rows := sqlmock.NewRows([]string{"grp", "bucket", "count"})
+			for _, r := range tt.rows {
+				rows.AddRow(r[0], r[1], r[2])
+			}
+			mock.ExpectQuery(tt.query).WithArgs("billing", start, end).WillReturnRows(rows)
+
+			h, err := els.EventHistogram(&EventSearchParams{Application: "billing", Start: start, End: end}, &tt.hp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Interval != DefaultHistogramInterval || !h.Start.Equal(start) || !h.End.Equal(end) {
+				t.Fatalf("unexpected histogram %+v", h)
+			}
+			if !reflect.DeepEqual(h.Series, tt.wantSeries) {
+				t.Fatalf("expected %+v, got %+v", tt.wantSeries, h.Series)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestEventHistogramRejectsBadParams(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		p       EventSearchParams
+		hp      EventHistogramParams
+		wantErr error
+	}{
+		{name: "unknown interval", hp: EventHistogramParams{Interval: "1w"}, wantErr: ErrInvalidInterval},
+		{name: "unknown group", hp: EventHistogramParams{GroupBy: "stack_trace"}, wantErr: ErrInvalidGroupBy},
+		{name: "ends before it starts", p: EventSearchParams{Start: now, End: now.Add(-time.Hour)}, wantErr: ErrInvalidTimeRange},
+		{name: "too many buckets", p: EventSearchParams{Start: now.Add(-MaxHistogramBuckets * time.Minute), End: now}, hp: EventHistogramParams{Interval: "1m"}, wantErr: ErrTooManyBuckets},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			if _, err := els.EventHistogram(&tt.p, &tt.hp); err != tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
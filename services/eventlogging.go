@@ -1,9 +1,13 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/StabbyCutyou/blunderbuss/logging"
 	"github.com/StabbyCutyou/blunderbuss/models"
 	"github.com/jmoiron/sqlx"
 )
@@ -12,20 +16,60 @@ import (
 type EventLoggingServiceConfig struct {
 	DB            *sqlx.DB
 	MetricService IMetricLoggingService
+	// Broadcaster is optional, when set every logged event is published to it
+	Broadcaster IEventBroadcaster
+	Limits      EventLimits
+	// DeleteBatchSize is how many events DeleteEvents removes per statement
+	DeleteBatchSize int
+	// IdempotencyRetention is how long idempotency keys are remembered for. Keys
+	// are ignored when it is 0
+	IdempotencyRetention time.Duration
 }
 
 // EventLoggingService is
 type EventLoggingService struct {
 	db            *sqlx.DB
 	metricService IMetricLoggingService
+	broadcaster   IEventBroadcaster
+	limits        EventLimits
+
+	deleteBatchSize      int
+	idempotencyRetention time.Duration
+	// lastKeyPurge is when expired idempotency keys were last purged, in unix nanoseconds
+	lastKeyPurge int64
+
+	// background tracks work running in the background, which Close waits for.
+	// Nothing more is started once closed is set
+	backgroundMu sync.Mutex
+	background   sync.WaitGroup
+	closed       bool
 }
 
 // IEventLoggingService is
 type IEventLoggingService interface {
+	PrepareEvent(e *models.Event) error
 	LogEvent(e *models.Event) error
+	LogEvents(es []*models.Event) error
+	GetEvent(id string) (*models.Event, error)
 	FindEvents(p *EventSearchParams) ([]models.Event, error)
+	FindEventsPage(p *EventSearchParams, pg *EventPageParams) (*EventPage, error)
+	ExportEvents(ctx context.Context, p *EventSearchParams, order string, each func(*models.Event) error) error
+	ContextKeys(ctx context.Context, p *EventSearchParams) ([]string, error)
+	DeleteEvents(p *EventDeleteParams) (int64, error)
+	EventHistogram(p *EventSearchParams, hp *EventHistogramParams) (*EventHistogram, error)
+	EventFacets(facet string, p *EventSearchParams, fp *FacetParams) ([]FacetValue, error)
+	Close()
 }
 
+// ErrEventNotFound is returned when looking up an event that does not exist
+var ErrEventNotFound = NewError(CodeNotFound, "Event not found")
+
+// ErrNilEvent is returned when asked to log a nil event
+var ErrNilEvent = NewError(CodeValidationFailed, "Cannot log nil events")
+
+// ErrNoSearchValues is returned when a search does not filter on anything
+var ErrNoSearchValues = NewError(CodeValidationFailed, "You must provide atleast one value to search")
+
 // EventSearchParams is
 type EventSearchParams struct {
 	Application    string    `json:"application"`
@@ -34,103 +78,212 @@ type EventSearchParams struct {
 	PartialMessage bool      `json:"partial_message"`
 	Start          time.Time `json:"start"`
 	End            time.Time `json:"end"`
+	// Applications restricts the search to these applications when set. It is
+	// filled in from the caller's API key, never from the request itself
+	Applications []string `json:"-"`
 }
 
-const insertEventQuery = "INSERT INTO events (application, type, message, context, stack_trace, created_at) VALUES ($1, $2, $3, $4, $5, $6)"
+const insertEventQuery = "INSERT INTO events (id, application, type, message, context, stack_trace, created_at, truncated_fields) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+
+const insertEventsQueryPrefix = "INSERT INTO events (id, application, type, message, context, stack_trace, created_at, truncated_fields) VALUES "
+
+const getEventQuery = "SELECT * FROM events WHERE id = $1"
+
+// eventColumnCount is the number of bound parameters each row in an insert uses
+const eventColumnCount = 8
+
+// maxEventsPerInsert keeps a single multi-row insert under the postgres limit
+// of 65535 bound parameters
+const maxEventsPerInsert = 65535 / eventColumnCount
 
 // NewEventLoggingService is
 func NewEventLoggingService(cfg *EventLoggingServiceConfig) (IEventLoggingService, error) {
 	return &EventLoggingService{
 		db:            cfg.DB,
 		metricService: cfg.MetricService,
+		broadcaster:   cfg.Broadcaster,
+		limits:        cfg.Limits,
+
+		deleteBatchSize:      cfg.DeleteBatchSize,
+		idempotencyRetention: cfg.IdempotencyRetention,
 	}, nil
 }
 
+// Close waits for work running in the background, such as purging expired
+// idempotency keys, and stops any more from starting. It must be called before
+// the database is closed
+func (els *EventLoggingService) Close() {
+	els.backgroundMu.Lock()
+	els.closed = true
+	els.backgroundMu.Unlock()
+	els.background.Wait()
+}
+
 // LogEvent will
 func (els *EventLoggingService) LogEvent(e *models.Event) error {
-	if e == nil {
-		return fmt.Errorf("Cannot log nil events")
-	}
-
-	args := make([]interface{}, 6)
-	args[0] = e.Application
-	args[1] = e.Type
-	args[2] = e.Message
-	args[3] = e.Context
-	args[4] = e.StackTrace
-	args[5] = e.CreatedAt
-
-	if _, err := els.db.Exec(insertEventQuery, args...); err != nil {
+	if err := els.PrepareEvent(e); err != nil {
 		return err
 	}
-	if err := els.metricService.RecordEvent(e); err != nil {
+	id, err := newEventID()
+	if err != nil {
 		return err
 	}
+	e.ID = id
+
+	// Deduplicating needs the key and the event written together
+	if els.usesIdempotencyKey(e) {
+		return els.insertEvents([]*models.Event{e})
+	}
+
+	defer els.observeQuery("insert_event", time.Now())
+	if _, err := els.db.Exec(insertEventQuery, eventArgs(e)...); err != nil {
+		return wrapDBError(err)
+	}
+	els.publish(e)
+	els.recordEvent(e)
 	return nil
 }
 
-// FindEvents will
-func (els *EventLoggingService) FindEvents(p *EventSearchParams) ([]models.Event, error) {
-	var evts []models.Event
-	if p.Application == "" && p.Type == "" && p.Message == "" {
-		return nil, fmt.Errorf("You must provide atleast one value to search")
-	}
-	query := "SELECT * FROM events WHERE "
-	paramCount := 0
-	needsAnd := false
-	args := make([]interface{}, 0, 3)
-	if p.Application != "" {
-		paramCount++
-		needsAnd = true
-		query += fmt.Sprintf("application = $%d", paramCount)
-		args = append(args, p.Application)
-	}
-
-	// Bucketting by time
-	if !p.Start.IsZero() || !p.End.IsZero() {
-		if needsAnd {
-			query += " AND "
+// LogEvents will write all of the provided events using multi-row inserts inside
+// of a single transaction. Either every event is stored, or none of them are.
+// Events whose idempotency key has been seen before are marked as replayed rather
+// than stored again
+func (els *EventLoggingService) LogEvents(es []*models.Event) error {
+	if len(es) == 0 {
+		return nil
+	}
+	for _, e := range es {
+		if err := els.PrepareEvent(e); err != nil {
+			return err
+		}
+		id, err := newEventID()
+		if err != nil {
+			return err
+		}
+		e.ID = id
+	}
+	return els.insertEvents(es)
+}
+
+// insertEvents writes prepared events in a single transaction, claiming the
+// idempotency keys of those that have one first. Replayed events are skipped
+func (els *EventLoggingService) insertEvents(es []*models.Event) error {
+	defer els.observeQuery("insert_events", time.Now())
+	now := time.Now()
+	tx, err := els.db.Beginx()
+	if err != nil {
+		return wrapDBError(err)
+	}
+
+	if err := els.claimIdempotencyKeys(tx, es, now); err != nil {
+		tx.Rollback()
+		return err
+	}
+	fresh := make([]*models.Event, 0, len(es))
+	keyed := false
+	for _, e := range es {
+		keyed = keyed || els.usesIdempotencyKey(e)
+		if !e.Replayed {
+			fresh = append(fresh, e)
+		}
+	}
+
+	for start := 0; start < len(fresh); start += maxEventsPerInsert {
+		end := start + maxEventsPerInsert
+		if end > len(fresh) {
+			end = len(fresh)
 		}
-		// It's going up by atleast one
-		paramCount++
-		if !p.Start.IsZero() && !p.End.IsZero() {
-			// BETWEEN
-			query += fmt.Sprintf("created_at BETWEEN $%d AND $%d", paramCount, paramCount+1)
-			// We used 2 params, up it again
-			paramCount++
-		} else if !p.Start.IsZero() {
-			// AFTER START
-			query += fmt.Sprintf("created_at >= $%d", paramCount)
-		} else if !p.End.IsZero() {
-			// BEFORE END
-			query += fmt.Sprintf("created_at <= $%d", paramCount)
+		query, args := buildInsertEventsQuery(fresh[start:end])
+		if _, err := tx.Exec(query, args...); err != nil {
+			tx.Rollback()
+			return wrapDBError(err)
 		}
-		needsAnd = true
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapDBError(err)
+	}
+	if keyed {
+		els.purgeIdempotencyKeys(now)
 	}
 
-	if p.Type != "" {
-		paramCount++
-		if needsAnd {
-			query += " AND "
-		} else {
-			needsAnd = true
+	for _, e := range fresh {
+		els.publish(e)
+	}
+	for _, e := range fresh {
+		els.recordEvent(e)
+	}
+	return nil
+}
+
+// recordEvent counts a stored event. It is only called once the event has been
+// committed, so a failure is logged rather than reported to the caller, who would
+// otherwise retry and store it again
+func (els *EventLoggingService) recordEvent(e *models.Event) {
+	if err := els.metricService.RecordEvent(e); err != nil {
+		logging.Warnf("unable to record metrics for event %s: %s", e.ID, err)
+	}
+}
+
+// observeQuery records how long the named query has taken since start. It is meant
+// to be deferred, as in defer els.observeQuery("get_event", time.Now())
+func (els *EventLoggingService) observeQuery(query string, start time.Time) {
+	els.metricService.RecordQuery(query, time.Since(start))
+}
+
+func (els *EventLoggingService) publish(e *models.Event) {
+	if els.broadcaster != nil {
+		els.broadcaster.Publish(e)
+	}
+}
+
+// GetEvent will return the event with the given id, or ErrEventNotFound if there
+// is no such event
+func (els *EventLoggingService) GetEvent(id string) (*models.Event, error) {
+	if !isEventID(id) {
+		return nil, ErrEventNotFound
+	}
+	defer els.observeQuery("get_event", time.Now())
+	e := &models.Event{}
+	if err := els.db.Get(e, getEventQuery, id); err != nil {
+		if isNoRows(err) {
+			return nil, ErrEventNotFound
 		}
-		query += fmt.Sprintf("type = $%d", paramCount)
-		args = append(args, p.Type)
+		return nil, wrapDBError(err)
 	}
+	return e, nil
+}
+
+func eventArgs(e *models.Event) []interface{} {
+	return []interface{}{e.ID, e.Application, e.Type, e.Message, e.Context, e.StackTrace, e.CreatedAt, e.Truncated}
+}
 
-	if p.Message != "" {
-		paramCount++
-		if p.PartialMessage {
-			query += fmt.Sprintf("type LIKE $" + fmt.Sprintf("%%%d%%", paramCount))
-		} else {
-			query += fmt.Sprintf("type = $%d", paramCount)
+func buildInsertEventsQuery(es []*models.Event) (string, []interface{}) {
+	var query bytes.Buffer
+	query.WriteString(insertEventsQueryPrefix)
+	args := make([]interface{}, 0, len(es)*eventColumnCount)
+	for i, e := range es {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for c := 1; c <= eventColumnCount; c++ {
+			if c > 1 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", i*eventColumnCount+c)
 		}
-		args = append(args, p.Message)
+		query.WriteString(")")
+		args = append(args, eventArgs(e)...)
 	}
-	err := els.db.Select(&evts, query, args...)
-	if evts == nil {
-		evts = make([]models.Event, 0)
+	return query.String(), args
+}
+
+// FindEvents will return the newest events matching the search, no more than
+// MaxPageLimit of them. FindEventsPage pages through the rest
+func (els *EventLoggingService) FindEvents(p *EventSearchParams) ([]models.Event, error) {
+	page, err := els.FindEventsPage(p, &EventPageParams{Limit: MaxPageLimit})
+	if err != nil {
+		return nil, err
 	}
-	return evts, err
+	return page.Events, nil
 }
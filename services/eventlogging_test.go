@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
+
+func TestLogEventsMetricErrors(t *testing.T) {
+	batch := func() []*models.Event {
+		return []*models.Event{{Application: "billing", Type: "error"}, {Application: "billing", Type: "error"}}
+	}
+	tests := []struct {
+		name       string
+		single     bool
+		metricsErr error
+		dbErr      error
+		wantErr    bool
+	}{
+		{name: "LogEvent", single: true},
+		{name: "LogEvent with metrics failing", single: true, metricsErr: errors.New("statsd unreachable")},
+		{name: "LogEvent with the database failing", single: true, dbErr: errors.New("connection reset"), wantErr: true},
+		{name: "LogEvents"},
+		{name: "LogEvents with metrics failing", metricsErr: errors.New("statsd unreachable")},
+		{name: "LogEvents with the database failing", dbErr: errors.New("connection reset"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			els.metricService = &fakeMetrics{err: tt.metricsErr}
+
+			var err error
+			if tt.single {
+				exec := mock.ExpectExec(insertEventQuery)
+				if tt.dbErr != nil {
+					exec.WillReturnError(tt.dbErr)
+				} else {
+					exec.WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				err = els.LogEvent(&models.Event{Application: "billing", Type: "error"})
+			} else {
+				es := batch()
+				query, _ := buildInsertEventsQuery(es)
+				mock.ExpectBegin()
+				exec := mock.ExpectExec(query)
+				if tt.dbErr != nil {
+					exec.WillReturnError(tt.dbErr)
+					mock.ExpectRollback()
+				} else {
+					exec.WillReturnResult(sqlmock.NewResult(0, 2))
+					mock.ExpectCommit()
+				}
+				err = els.LogEvents(es)
+			}
+
+			// Once stored, the events were logged whether or not they were counted
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestLogEventAssignsID(t *testing.T) {
+	els, mock := newMockService(t)
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		mock.ExpectExec(insertEventQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+		// Any id sent by the client is replaced
+		e := &models.Event{ID: "chosen-by-the-client", Application: "billing", Type: "error"}
+		if err := els.LogEvent(e); err != nil {
+			t.Fatal(err)
+		}
+		if !isEventID(e.ID) || seen[e.ID] {
+			t.Fatalf("expected a new event id, got %q", e.ID)
+		}
+		seen[e.ID] = true
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetEvent(t *testing.T) {
+	const id = "0b7c7ad4-3c4e-4d5a-9f7e-3f0b5e1f2a6c"
+	tests := []struct {
+		name     string
+		id       string
+		rows     *sqlmock.Rows
+		dbErr    error
+		wantCode ErrorCode
+	}{
+		{name: "found", id: id, rows: sqlmock.NewRows([]string{"id", "application", "type"}).AddRow(id, "billing", "error")},
+		{name: "missing", id: id, rows: sqlmock.NewRows([]string{"id", "application", "type"}), wantCode: CodeNotFound},
+		// Anything that isn't an id can't be an event, so the database isn't asked
+		{name: "not an id", id: "1; DROP TABLE events", wantCode: CodeNotFound},
+		{name: "database failing", id: id, dbErr: errors.New("syntax error"), wantCode: CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			if tt.rows != nil {
+				mock.ExpectQuery(getEventQuery).WithArgs(tt.id).WillReturnRows(tt.rows)
+			} else if tt.dbErr != nil {
+				mock.ExpectQuery(getEventQuery).WithArgs(tt.id).WillReturnError(tt.dbErr)
+			}
+
+			e, err := els.GetEvent(tt.id)
+			if tt.wantCode != "" {
+				if ErrorCodeOf(err) != tt.wantCode {
+					t.Fatalf("expected a %s error, got %v", tt.wantCode, err)
+				}
+			} else if err != nil || e.ID != id || e.Application != "billing" {
+				t.Fatalf("expected event %s, got %+v, %v", id, e, err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
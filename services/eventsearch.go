@@ -0,0 +1,187 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/lib/pq"
+)
+
+// DefaultPageLimit is the page size used when a search does not ask for one
+const DefaultPageLimit = 100
+
+// MaxPageLimit is the largest page size a search may ask for
+const MaxPageLimit = 1000
+
+const (
+	// OrderDesc returns the newest events first
+	OrderDesc = "desc"
+	// OrderAsc returns the oldest events first
+	OrderAsc = "asc"
+)
+
+// ErrInvalidCursor is returned when a search is given a cursor it did not produce
+var ErrInvalidCursor = NewError(CodeInvalidRequest, "Invalid cursor")
+
+// ErrInvalidOrder is returned when a search is given an order other than asc or desc
+var ErrInvalidOrder = NewError(CodeInvalidRequest, "Order must be one of asc or desc")
+
+// EventPageParams controls which page of a search is returned
+type EventPageParams struct {
+	Limit  int
+	Order  string
+	Cursor string
+}
+
+// EventPage is a single page of search results. NextCursor is empty when there
+// are no more results
+type EventPage struct {
+	Events     []models.Event `json:"events"`
+	NextCursor string         `json:"next_cursor"`
+}
+
+// pageCursor is the position of the last event on a page. It is handed to clients
+// base64 encoded so that they treat it as opaque
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+func encodeCursor(e *models.Event) string {
+	b, _ := json.Marshal(pageCursor{CreatedAt: e.CreatedAt, ID: e.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &pageCursor{}
+	if err := json.Unmarshal(b, c); err != nil || !isEventID(c.ID) {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// FindEventsPage will return a single page of the events matching the search, ordered
+// by (created_at, id) so that the cursor can be used for keyset pagination
+func (els *EventLoggingService) FindEventsPage(p *EventSearchParams, pg *EventPageParams) (*EventPage, error) {
+	if p.Application == "" && p.Type == "" && p.Message == "" {
+		return nil, ErrNoSearchValues
+	}
+
+	limit := pg.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	order, err := parseOrder(pg.Order, OrderDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	where := searchConditions(p)
+	if pg.Cursor != "" {
+		c, err := decodeCursor(pg.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if order == OrderDesc {
+			where.add("(created_at, id) < (%s, %s)", c.CreatedAt, c.ID)
+		} else {
+			where.add("(created_at, id) > (%s, %s)", c.CreatedAt, c.ID)
+		}
+	}
+
+	// Ask for one more than the limit, so we know if there is another page
+	query := fmt.Sprintf("SELECT * FROM events%s ORDER BY created_at %s, id %s LIMIT %d", where.String(), order, order, limit+1)
+	defer els.observeQuery("find_events_page", time.Now())
+	evts := make([]models.Event, 0)
+	if err := els.db.Select(&evts, query, where.args...); err != nil {
+		return nil, wrapDBError(err)
+	}
+
+	page := &EventPage{Events: evts}
+	if len(evts) > limit {
+		page.Events = evts[:limit]
+		page.NextCursor = encodeCursor(&page.Events[limit-1])
+	}
+	return page, nil
+}
+
+// parseOrder validates a requested sort order, using def when none was given
+func parseOrder(order, def string) (string, error) {
+	order = strings.ToLower(order)
+	if order == "" {
+		return def, nil
+	}
+	if order != OrderDesc && order != OrderAsc {
+		return "", ErrInvalidOrder
+	}
+	return order, nil
+}
+
+// whereClause accumulates the conditions and bound arguments for a query
+type whereClause struct {
+	conds []string
+	args  []interface{}
+}
+
+// add appends a condition. Each %s in cond is replaced by the placeholder
+// for the matching value in args
+func (w *whereClause) add(cond string, args ...interface{}) {
+	placeholders := make([]interface{}, len(args))
+	for i, a := range args {
+		w.args = append(w.args, a)
+		placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	w.conds = append(w.conds, fmt.Sprintf(cond, placeholders...))
+}
+
+// String renders the WHERE clause, including the leading WHERE keyword
+func (w *whereClause) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+func searchConditions(p *EventSearchParams) *whereClause {
+	w := &whereClause{}
+	if p.Application != "" {
+		w.add("application = %s", p.Application)
+	}
+	if p.Applications != nil {
+		w.add("application = ANY(%s)", pq.StringArray(p.Applications))
+	}
+
+	// Bucketting by time
+	if !p.Start.IsZero() && !p.End.IsZero() {
+		w.add("created_at BETWEEN %s AND %s", p.Start, p.End)
+	} else if !p.Start.IsZero() {
+		w.add("created_at >= %s", p.Start)
+	} else if !p.End.IsZero() {
+		w.add("created_at <= %s", p.End)
+	}
+
+	if p.Type != "" {
+		w.add("type = %s", p.Type)
+	}
+
+	if p.Message != "" {
+		if p.PartialMessage {
+			w.add("message LIKE '%%' || %s || '%%'", escapeLike(p.Message))
+		} else {
+			w.add("message = %s", p.Message)
+		}
+	}
+	return w
+}
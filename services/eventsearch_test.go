@@ -0,0 +1,183 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// fakeMetrics records nothing, and returns err from RecordEvent
+type fakeMetrics struct {
+	err error
+}
+
+func (f *fakeMetrics) RecordEvent(e *models.Event) error                             { return f.err }
+func (f *fakeMetrics) RecordRejected(application string, reason string, n int) error { return nil }
+func (f *fakeMetrics) RecordRateLimited(kind string, key string, dropped int) error  { return nil }
+func (f *fakeMetrics) RecordQuery(query string, d time.Duration) error               { return nil }
+
+// newMockService returns a service backed by sqlmock, which expects queries to be
+// exactly those given
+func newMockService(t *testing.T) (*EventLoggingService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &EventLoggingService{db: sqlx.NewDb(db, "postgres"), metricService: &fakeMetrics{}}, mock
+}
+
+func TestPageCursor(t *testing.T) {
+	e := &models.Event{ID: "0b7c7ad4-3c4e-4d5a-9f7e-3f0b5e1f2a6c", CreatedAt: time.Date(2026, 3, 4, 5, 6, 7, 890, time.UTC)}
+	c, err := decodeCursor(encodeCursor(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != e.ID || !c.CreatedAt.Equal(e.CreatedAt) {
+		t.Fatalf("expected %s at %s, got %s at %s", e.ID, e.CreatedAt, c.ID, c.CreatedAt)
+	}
+
+	invalid := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "not json", cursor: base64.RawURLEncoding.EncodeToString([]byte("nope"))},
+		{name: "not an event id", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2026-03-04T05:06:07Z","id":"1; DROP TABLE events"}`))},
+		{name: "missing id", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2026-03-04T05:06:07Z"}`))},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor); err != ErrInvalidCursor {
+				t.Fatalf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSearchConditions(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	tests := []struct {
+		name      string
+		params    EventSearchParams
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{name: "nothing", wantWhere: ""},
+		{name: "application and type", params: EventSearchParams{Application: "billing", Type: "error"}, wantWhere: " WHERE application = $1 AND type = $2", wantArgs: []interface{}{"billing", "error"}},
+		{name: "scoped to a key's applications", params: EventSearchParams{Type: "error", Applications: []string{"billing"}}, wantWhere: " WHERE application = ANY($1) AND type = $2", wantArgs: []interface{}{pq.StringArray{"billing"}, "error"}},
+		{name: "between", params: EventSearchParams{Start: start, End: end}, wantWhere: " WHERE created_at BETWEEN $1 AND $2", wantArgs: []interface{}{start, end}},
+		{name: "from", params: EventSearchParams{Start: start}, wantWhere: " WHERE created_at >= $1", wantArgs: []interface{}{start}},
+		{name: "until", params: EventSearchParams{End: end}, wantWhere: " WHERE created_at <= $1", wantArgs: []interface{}{end}},
+		{name: "exact message", params: EventSearchParams{Message: "50%_off"}, wantWhere: " WHERE message = $1", wantArgs: []interface{}{"50%_off"}},
+		{name: "partial message is escaped", params: EventSearchParams{Message: `50%_off\`, PartialMessage: true}, wantWhere: " WHERE message LIKE '%' || $1 || '%'", wantArgs: []interface{}{`50\%\_off\\`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := searchConditions(&tt.params)
+			if w.String() != tt.wantWhere {
+				t.Fatalf("expected %q, got %q", tt.wantWhere, w.String())
+			}
+			if len(w.args) != len(tt.wantArgs) || (len(w.args) > 0 && !reflect.DeepEqual(w.args, tt.wantArgs)) {
+				t.Fatalf("expected args %v, got %v", tt.wantArgs, w.args)
+			}
+		})
+	}
+}
+
+func TestFindEventsPage(t *testing.T) {
+	first := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ids := []string{
+		"00000000-0000-4000-8000-000000000001",
+		"00000000-0000-4000-8000-000000000002",
+		"00000000-0000-4000-8000-000000000003",
+	}
+	cursor := encodeCursor(&models.Event{ID: ids[0], CreatedAt: first})
+	columns := []string{"id", "application", "type", "message", "created_at"}
+
+	tests := []struct {
+		name       string
+		page       EventPageParams
+		wantQuery  string
+		wantArgs   []interface{}
+		rows       int
+		wantEvents int
+		wantNext   bool
+		wantErr    error
+	}{
+		{name: "first page, newest first", page: EventPageParams{Limit: 2}, wantQuery: "SELECT * FROM events WHERE application = $1 ORDER BY created_at desc, id desc LIMIT 3", rows: 3, wantEvents: 2, wantNext: true},
+		{name: "last page", page: EventPageParams{Limit: 2}, wantQuery: "SELECT * FROM events WHERE application = $1 ORDER BY created_at desc, id desc LIMIT 3", rows: 2, wantEvents: 2},
+		{name: "after a cursor, newest first", page: EventPageParams{Limit: 2, Cursor: cursor}, wantQuery: "SELECT * FROM events WHERE application = $1 AND (created_at, id) < ($2, $3) ORDER BY created_at desc, id desc LIMIT 3", wantArgs: []interface{}{first, ids[0]}, rows: 1, wantEvents: 1},
+		{name: "after a cursor, oldest first", page: EventPageParams{Limit: 2, Order: "ASC", Cursor: cursor}, wantQuery: "SELECT * FROM events WHERE application = $1 AND (created_at, id) > ($2, $3) ORDER BY created_at asc, id asc LIMIT 3", wantArgs: []interface{}{first, ids[0]}, rows: 3, wantEvents: 2, wantNext: true},
+		{name: "default limit", wantQuery: "SELECT * FROM events WHERE application = $1 ORDER BY created_at desc, id desc LIMIT 101"},
+		{name: "limit is capped", page: EventPageParams{Limit: MaxPageLimit * 10}, wantQuery: "SELECT * FROM events WHERE application = $1 ORDER BY created_at desc, id desc LIMIT 1001"},
+		{name: "bad order", page: EventPageParams{Order: "sideways"}, wantErr: ErrInvalidOrder},
+		{name: "bad cursor", page: EventPageParams{Cursor: "nope"}, wantErr: ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			if tt.wantQuery != "" {
+				args := []driver.Value{"billing"}
+				for _, a := range tt.wantArgs {
+					args = append(args, a)
+				}
+				rows := sqlmock.NewRows(columns)
+				for i := 0; i < tt.rows; i++ {
+					rows.AddRow(ids[i], "billing", "error", "boom", first.Add(time.Duration(i)*time.Second))
+				}
+				mock.ExpectQuery(tt.wantQuery).WithArgs(args...).WillReturnRows(rows)
+			}
+
+			page, err := els.FindEventsPage(&EventSearchParams{Application: "billing"}, &tt.page)
+			if tt.wantErr != nil {
+				if err != tt.wantErr {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(page.Events) != tt.wantEvents {
+				t.Fatalf("expected %d events, got %d", tt.wantEvents, len(page.Events))
+			}
+			if (page.NextCursor != "") != tt.wantNext {
+				t.Fatalf("expected a next cursor %v, got %q", tt.wantNext, page.NextCursor)
+			}
+			// The next page starts after the last event returned on this one
+			if tt.wantNext {
+				c, err := decodeCursor(page.NextCursor)
+				last := page.Events[len(page.Events)-1]
+				if err != nil || c.ID != last.ID || !c.CreatedAt.Equal(last.CreatedAt) {
+					t.Fatalf("expected a cursor at %s, got %+v, %v", last.ID, c, err)
+				}
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFindEventsIsCapped(t *testing.T) {
+	els, mock := newMockService(t)
+	mock.ExpectQuery("SELECT * FROM events WHERE application = $1 ORDER BY created_at desc, id desc LIMIT 1001").
+		WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if _, err := els.FindEvents(&EventSearchParams{Application: "billing"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
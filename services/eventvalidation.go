@@ -0,0 +1,203 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
+
+// TruncationMarker is appended to any value which was cut short to fit a limit
+const TruncationMarker = "...[truncated]"
+
+// FieldError describes a single field which failed validation. Path is a JSON
+// pointer to the field
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// EventLimits bounds the size of the events we'll store. A zero limit is unlimited
+type EventLimits struct {
+	MaxApplicationLength int
+	MaxTypeLength        int
+	MaxMessageLength     int
+	MaxStackTraceLength  int
+	// MaxContextDepth is how deeply objects and arrays may nest within context
+	MaxContextDepth int
+	// MaxContextKeys is the total number of keys allowed across every object in
+	// context, with each element of an array counting as a key
+	MaxContextKeys int
+	// RequiredFields are the json names of fields which may not be empty
+	RequiredFields []string
+}
+
+// PrepareEvent will check that e has every required field, and that its application,
+// type and event_id are within their limits. The message, stack trace and context
+// are truncated instead when they are over their limits, recording which fields
+// were truncated on the event. It is safe to call more than once on the same event.
+//
+// Events with an oversized application or type are deliberately rejected, rather
+// than truncated as the other fields are. They are identifiers, searched for
+// exactly, and a truncated one would file the event under an application or type
+// that its sender never named, and may not be allowed to write to
+func (els *EventLoggingService) PrepareEvent(e *models.Event) error {
+	if e == nil {
+		return ErrNilEvent
+	}
+	l := els.limits
+
+	var missing []FieldError
+	for _, field := range l.RequiredFields {
+		if eventFieldValue(e, field) == "" {
+			missing = append(missing, FieldError{Path: "/" + field, Message: "is required"})
+		}
+	}
+	if len(missing) > 0 {
+		return &Error{Code: CodeValidationFailed, Message: "Event is missing required fields", Details: missing}
+	}
+	// Identifiers are compared exactly, and the application has already been
+	// authorized and rate limited by name, so unlike other fields they can't be
+	// truncated
+	var tooLong []FieldError
+	checkLength := func(field string, value string, max int) {
+		if max > 0 && len(value) > max {
+			tooLong = append(tooLong, FieldError{Path: "/" + field, Message: fmt.Sprintf("must be at most %d bytes", max)})
+		}
+	}
+	checkLength("application", e.Application, l.MaxApplicationLength)
+	checkLength("type", e.Type, l.MaxTypeLength)
+	checkLength("event_id", e.IdempotencyKey, MaxIdempotencyKeyLength)
+	if len(tooLong) > 0 {
+		return &Error{Code: CodeValidationFailed, Message: "Event has fields which are too long", Details: tooLong}
+	}
+
+	truncate := func(field string, value *string, max int) {
+		if t, ok := truncateString(*value, max); ok {
+			*value = t
+			e.Truncated = appendUnique(e.Truncated, field)
+		}
+	}
+	truncate("message", &e.Message, l.MaxMessageLength)
+	truncate("stack_trace", &e.StackTrace, l.MaxStackTraceLength)
+
+	if l.MaxContextDepth > 0 || l.MaxContextKeys > 0 {
+		ctxt, truncated, err := truncateContext(e.Context, l.MaxContextDepth, l.MaxContextKeys)
+		if err != nil {
+			return WrapError(CodeValidationFailed, "Event context is not valid JSON", err)
+		}
+		if truncated {
+			e.Context = ctxt
+			e.Truncated = appendUnique(e.Truncated, "context")
+		}
+	}
+	return nil
+}
+
+func eventFieldValue(e *models.Event, field string) string {
+	switch field {
+	case "application":
+		return e.Application
+	case "type":
+		return e.Type
+	case "message":
+		return e.Message
+	case "stack_trace":
+		return e.StackTrace
+	}
+	return ""
+}
+
+// truncateString cuts s down to max bytes, including the marker, without splitting
+// a multi-byte character. A limit too small to fit the marker gets no marker
+func truncateString(s string, max int) (string, bool) {
+	if max <= 0 || len(s) <= max {
+		return s, false
+	}
+	marker := TruncationMarker
+	if max < len(marker) {
+		marker = ""
+	}
+	keep := max - len(marker)
+	for keep > 0 && !utf8.RuneStart(s[keep]) {
+		keep--
+	}
+	return s[:keep] + marker, true
+}
+
+// truncateContext replaces anything nested deeper than maxDepth with the marker,
+// and drops keys and array elements once maxKeys of them have been seen. Keys are
+// visited in sorted order, so the same context is always truncated the same way
+func truncateContext(ctxt []byte, maxDepth int, maxKeys int) ([]byte, bool, error) {
+	if len(ctxt) == 0 {
+		return ctxt, false, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(ctxt, &v); err != nil {
+		return nil, false, err
+	}
+	t := &contextTruncator{maxDepth: maxDepth, maxKeys: maxKeys}
+	v = t.walk(v, 0)
+	if !t.truncated {
+		return ctxt, false, nil
+	}
+	b, err := json.Marshal(v)
+	return b, true, err
+}
+
+type contextTruncator struct {
+	maxDepth  int
+	maxKeys   int
+	keys      int
+	truncated bool
+}
+
+func (t *contextTruncator) walk(v interface{}, depth int) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if t.maxDepth > 0 && depth >= t.maxDepth {
+			t.truncated = true
+			return TruncationMarker
+		}
+		names := make([]string, 0, len(val))
+		for k := range val {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		out := make(map[string]interface{}, len(val))
+		for _, k := range names {
+			if t.maxKeys > 0 && t.keys >= t.maxKeys {
+				t.truncated = true
+				break
+			}
+			t.keys++
+			out[k] = t.walk(val[k], depth+1)
+		}
+		return out
+	case []interface{}:
+		if t.maxDepth > 0 && depth >= t.maxDepth {
+			t.truncated = true
+			return TruncationMarker
+		}
+		out := make([]interface{}, 0, len(val))
+		for _, elem := range val {
+			if t.maxKeys > 0 && t.keys >= t.maxKeys {
+				t.truncated = true
+				break
+			}
+			t.keys++
+			out = append(out, t.walk(elem, depth+1))
+		}
+		return out
+	}
+	return v
+}
+
+func appendUnique(list []string, s string) []string {
+	if containsString(list, s) {
+		return list
+	}
+	return append(list, s)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		name      string
+		s         string
+		max       int
+		want      string
+		truncated bool
+	}{
+		{name: "unlimited", s: "hello", max: 0, want: "hello"},
+		{name: "under the limit", s: "hello", max: 10, want: "hello"},
+		{name: "at the limit", s: "hello", max: 5, want: "hello"},
+		{name: "over the limit", s: strings.Repeat("a", 30), max: 20, want: "aaaaaa" + TruncationMarker, truncated: true},
+		{name: "room for only the marker", s: strings.Repeat("a", 30), max: len(TruncationMarker), want: TruncationMarker, truncated: true},
+		{name: "limit smaller than the marker", s: strings.Repeat("a", 30), max: 5, want: "aaaaa", truncated: true},
+		{name: "limit of one", s: "ab", max: 1, want: "a", truncated: true},
+		// é is two bytes, so cutting at 7 would split the fourth one
+		{name: "multi-byte character at the cut", s: strings.Repeat("é", 20), max: 7 + len(TruncationMarker), want: "ééé" + TruncationMarker, truncated: true},
+		{name: "multi-byte character with no marker", s: "ééé", max: 3, want: "é", truncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateString(tt.s, tt.max)
+			if got != tt.want || truncated != tt.truncated {
+				t.Fatalf("expected %q, %v, got %q, %v", tt.want, tt.truncated, got, truncated)
+			}
+			if tt.max > 0 && len(got) > tt.max {
+				t.Fatalf("%q is longer than the limit of %d", got, tt.max)
+			}
+			if !utf8.ValidString(got) {
+				t.Fatalf("%q is not valid utf8", got)
+			}
+		})
+	}
+}
+
+func TestPrepareEvent(t *testing.T) {
+	limits := EventLimits{
+		MaxApplicationLength: 8,
+		MaxTypeLength:        8,
+		MaxMessageLength:     20,
+		MaxStackTraceLength:  20,
+		MaxContextDepth:      2,
+		MaxContextKeys:       3,
+		RequiredFields:       []string{"application", "type"},
+	}
+	long := strings.Repeat("x", 30)
+
+	tests := []struct {
+		name          string
+		event         models.Event
+		wantFields    []string
+		wantTruncated []string
+		wantContext   string
+	}{
+		{name: "within limits", event: models.Event{Application: "app", Type: "error", Message: "boom"}},
+		{name: "missing required fields", event: models.Event{Message: "boom"}, wantFields: []string{"/application", "/type"}},
+		{name: "application too long", event: models.Event{Application: long, Type: "error"}, wantFields: []string{"/application"}},
+		{name: "type too long", event: models.Event{Application: "app", Type: long}, wantFields: []string{"/type"}},
+		{name: "event_id too long", event: models.Event{Application: "app", Type: "error", IdempotencyKey: strings.Repeat("k", MaxIdempotencyKeyLength+1)}, wantFields: []string{"/event_id"}},
+		{name: "message and stack trace truncated", event: models.Event{Application: "app", Type: "error", Message: long, StackTrace: long}, wantTruncated: []string{"message", "stack_trace"}},
+		{name: "context too deep", event: models.Event{Application: "app", Type: "error", Context: []byte(`{"a":{"b":{"c":1}}}`)}, wantTruncated: []string{"context"}, wantContext: `{"a":{"b":"` + TruncationMarker + `"}}`},
+		{name: "context with too many keys", event: models.Event{Application: "app", Type: "error", Context: []byte(`{"d":1,"c":2,"b":3,"a":4}`)}, wantTruncated: []string{"context"}, wantContext: `{"a":4,"b":3,"c":2}`},
+		{name: "context with too many array elements", event: models.Event{Application: "app", Type: "error", Context: []byte(`[1,2,3,4,5]`)}, wantTruncated: []string{"context"}, wantContext: `[1,2,3]`},
+		{name: "array elements and keys counted together", event: models.Event{Application: "app", Type: "error", Context: []byte(`{"a":[1,2,3]}`)}, wantTruncated: []string{"context"}, wantContext: `{"a":[1,2]}`},
+		{name: "array within the limit", event: models.Event{Application: "app", Type: "error", Context: []byte(`{"a":[1,2]}`)}},
+	}
+
+	els := &EventLoggingService{limits: limits}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.event
+			err := els.PrepareEvent(&e)
+			if tt.wantFields != nil {
+				se, ok := err.(*Error)
+				if !ok || se.Code != CodeValidationFailed {
+					t.Fatalf("expected a validation error, got %v", err)
+				}
+				var paths []string
+				for _, f := range se.Details.([]FieldError) {
+					paths = append(paths, f.Path)
+				}
+				if !reflect.DeepEqual(paths, tt.wantFields) {
+					t.Fatalf("expected failures for %v, got %v", tt.wantFields, paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual([]string(e.Truncated), tt.wantTruncated) {
+				t.Fatalf("expected %v to be truncated, got %v", tt.wantTruncated, e.Truncated)
+			}
+			if tt.wantContext != "" && string(e.Context) != tt.wantContext {
+				t.Fatalf("expected context %s, got %s", tt.wantContext, e.Context)
+			}
+
+			// Preparing an event a second time changes nothing
+			again := e
+			if err = els.PrepareEvent(&again); err != nil || !reflect.DeepEqual(again, e) {
+				t.Fatalf("second prepare changed the event: %+v, %v", again, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// HealthOK means a component is working
+	HealthOK = "ok"
+	// HealthUnavailable means a component is not working
+	HealthUnavailable = "unavailable"
+)
+
+// HealthServiceConfig is
+type HealthServiceConfig struct {
+	DB          *sqlx.DB
+	Broadcaster IEventBroadcaster
+	// Statsd describes where metrics are being sent. UDP gives us no way to tell if
+	// the sink is actually receiving them, so it is reported but never fails a check
+	Statsd *StatsdConfig
+	// Timeout bounds how long any single check may take
+	Timeout time.Duration
+}
+
+// HealthService is
+type HealthService struct {
+	db          *sqlx.DB
+	broadcaster IEventBroadcaster
+	statsd      *StatsdConfig
+	timeout     time.Duration
+}
+
+// IHealthService is
+type IHealthService interface {
+	Check(ctx context.Context) *HealthReport
+}
+
+// HealthReport is the result of checking every component the service depends on.
+// Status is only HealthOK if every component is
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// ComponentHealth is the result of checking a single component
+type ComponentHealth struct {
+	Status    string      `json:"status"`
+	LatencyMs float64     `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// DefaultHealthCheckTimeout is used when HealthServiceConfig.Timeout is not set
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// NewHealthService is
+func NewHealthService(cfg *HealthServiceConfig) (IHealthService, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	return &HealthService{
+		db:          cfg.DB,
+		broadcaster: cfg.Broadcaster,
+		statsd:      cfg.Statsd,
+		timeout:     timeout,
+	}, nil
+}
+
+// Check will check each component in turn
+func (h *HealthService) Check(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Status:     HealthOK,
+		Components: make(map[string]ComponentHealth),
+	}
+	report.add("database", h.timed(func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+		if err := h.db.PingContext(ctx); err != nil {
+			return nil, err
+		}
+		return h.db.Stats(), nil
+	}))
+	if h.statsd != nil {
+		report.add("statsd", h.timed(func() (interface{}, error) {
+			return map[string]interface{}{
+				"enabled": h.statsd.Enabled,
+				"type":    h.statsd.Type,
+				"address": h.statsd.Address,
+			}, nil
+		}))
+	}
+	if h.broadcaster != nil {
+		report.add("stream", h.timed(func() (interface{}, error) {
+			return h.broadcaster.Stats(), nil
+		}))
+	}
+	return report
+}
+
+func (r *HealthReport) add(name string, c ComponentHealth) {
+	r.Components[name] = c
+	if c.Status != HealthOK {
+		r.Status = HealthUnavailable
+	}
+}
+
+func (h *HealthService) timed(check func() (interface{}, error)) ComponentHealth {
+	start := time.Now()
+	details, err := check()
+	c := ComponentHealth{
+		Status:    HealthOK,
+		LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+		Details:   details,
+	}
+	if err != nil {
+		c.Status = HealthUnavailable
+		c.Error = err.Error()
+	}
+	return c
+}
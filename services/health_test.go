@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestHealthCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		pingErr    error
+		pingDelay  time.Duration
+		wantStatus string
+	}{
+		{name: "healthy", wantStatus: HealthOK},
+		{name: "database down", pingErr: errors.New("connection refused"), wantStatus: HealthUnavailable},
+		{name: "database too slow", pingDelay: time.Second, wantStatus: HealthUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mock.ExpectPing().WillDelayFor(tt.pingDelay).WillReturnError(tt.pingErr)
+
+			broadcaster, _ := NewEventBroadcaster(&EventBroadcasterConfig{BufferSize: 10})
+			broadcaster.Subscribe(nil)
+			hs, err := NewHealthService(&HealthServiceConfig{
+				DB:          sqlx.NewDb(db, "postgres"),
+				Broadcaster: broadcaster,
+				Statsd:      &StatsdConfig{Enabled: true, Type: "statsd", Address: "127.0.0.1:8125"},
+				Timeout:     50 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			report := hs.Check(context.Background())
+			if time.Since(start) > 500*time.Millisecond {
+				t.Fatalf("check took %s, longer than its timeout", time.Since(start))
+			}
+			if report.Status != tt.wantStatus || report.Components["database"].Status != tt.wantStatus {
+				t.Fatalf("expected %s, got %+v", tt.wantStatus, report)
+			}
+			if tt.wantStatus != HealthOK && report.Components["database"].Error == "" {
+				t.Fatal("expected the database error to be reported")
+			}
+			// Statsd can't be checked over UDP, so it never fails the report
+			if report.Components["statsd"].Status != HealthOK {
+				t.Fatalf("expected statsd to be reported ok, got %+v", report.Components["statsd"])
+			}
+			stream := report.Components["stream"]
+			if stats, ok := stream.Details.(BroadcasterStats); stream.Status != HealthOK || !ok || stats.Subscribers != 1 || stats.BufferSize != 10 {
+				t.Fatalf("expected the stream's queue to be reported, got %+v", stream)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/logging"
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// MaxIdempotencyKeyLength is the longest idempotency key an event may carry
+const MaxIdempotencyKeyLength = 255
+
+// idempotencyPurgeInterval is the least time between purges of expired keys
+const idempotencyPurgeInterval = 10 * time.Minute
+
+// claimIdempotencyKeysQuery records the keys for a batch of new events in a single
+// statement. A key that has outlived the retention window is taken over, one that
+// hasn't is left alone and isn't returned. Keys are claimed in a fixed order so
+// that batches sharing keys wait on one another rather than deadlock
+const claimIdempotencyKeysQuery = `INSERT INTO idempotency_keys (application, key, event_id, created_at)
+SELECT application, key, event_id, $4 FROM unnest($1::text[], $2::text[], $3::uuid[]) AS claims (application, key, event_id)
+ORDER BY application, key
+ON CONFLICT (application, key) DO UPDATE SET event_id = EXCLUDED.event_id, created_at = EXCLUDED.created_at
+WHERE idempotency_keys.created_at < $5
+RETURNING application, key, event_id`
+
+const getIdempotencyKeysQuery = `SELECT application, key, event_id FROM idempotency_keys
+WHERE (application, key) IN (SELECT * FROM unnest($1::text[], $2::text[]))`
+
+const purgeIdempotencyKeysQuery = "DELETE FROM idempotency_keys WHERE created_at < $1"
+
+// idempotencyKey identifies the events that are copies of one another
+type idempotencyKey struct {
+	Application string `db:"application"`
+	Key         string `db:"key"`
+}
+
+// idempotencyKeyRow is a key and the event it was first logged as
+type idempotencyKeyRow struct {
+	idempotencyKey
+	EventID string `db:"event_id"`
+}
+
+// claimIdempotencyKeys records that the events of es with a key are being logged
+// under it, as part of tx. Events whose key was already used within the retention
+// window, or earlier in es, are marked as replayed and given the id of the event
+// logged the first time. Concurrent claims of the same key wait on one another, so
+// only one of them is ever logged
+func (els *EventLoggingService) claimIdempotencyKeys(tx *sqlx.Tx, es []*models.Event, now time.Time) error {
+	first := make(map[idempotencyKey]*models.Event)
+	claims := make([]idempotencyKey, 0, len(es))
+	for _, e := range es {
+		if !els.usesIdempotencyKey(e) {
+			continue
+		}
+		k := idempotencyKey{Application: e.Application, Key: e.IdempotencyKey}
+		if _, ok := first[k]; !ok {
+			first[k] = e
+			claims = append(claims, k)
+		}
+	}
+	if len(claims) == 0 {
+		return nil
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		if claims[i].Application != claims[j].Application {
+			return claims[i].Application < claims[j].Application
+		}
+		return claims[i].Key < claims[j].Key
+	})
+
+	apps := make(pq.StringArray, len(claims))
+	keys := make(pq.StringArray, len(claims))
+	ids := make(pq.StringArray, len(claims))
+	for i, k := range claims {
+		apps[i], keys[i], ids[i] = k.Application, k.Key, first[k].ID
+	}
+	claimed := make([]idempotencyKeyRow, 0, len(claims))
+	if err := tx.Select(&claimed, claimIdempotencyKeysQuery, apps, keys, ids, now, now.Add(-els.idempotencyRetention)); err != nil {
+		return wrapDBError(err)
+	}
+
+	// Look up the events logged under keys which were already held
+	if len(claimed) < len(claims) {
+		held := make(map[idempotencyKey]bool, len(claims))
+		for _, k := range claims {
+			held[k] = true
+		}
+		for _, r := range claimed {
+			delete(held, r.idempotencyKey)
+		}
+		apps, keys = apps[:0], keys[:0]
+		for _, k := range claims {
+			if held[k] {
+				apps, keys = append(apps, k.Application), append(keys, k.Key)
+			}
+		}
+		existing := make([]idempotencyKeyRow, 0, len(apps))
+		if err := tx.Select(&existing, getIdempotencyKeysQuery, apps, keys); err != nil {
+			return wrapDBError(err)
+		}
+		for _, r := range existing {
+			if e, ok := first[r.idempotencyKey]; ok {
+				e.ID = r.EventID
+				e.Replayed = true
+			}
+		}
+	}
+
+	for _, e := range es {
+		if !els.usesIdempotencyKey(e) {
+			continue
+		}
+		if f := first[idempotencyKey{Application: e.Application, Key: e.IdempotencyKey}]; f != e {
+			e.ID = f.ID
+			e.Replayed = true
+		}
+	}
+	return nil
+}
+
+// usesIdempotencyKey reports whether e should be deduplicated
+func (els *EventLoggingService) usesIdempotencyKey(e *models.Event) bool {
+	return els.idempotencyRetention > 0 && e.IdempotencyKey != ""
+}
+
+// purgeIdempotencyKeys deletes keys that have outlived the retention window, at
+// most once every idempotencyPurgeInterval. The delete runs in the background,
+// so callers aren't held up by it, and Close waits for it
+func (els *EventLoggingService) purgeIdempotencyKeys(now time.Time) {
+	last := atomic.LoadInt64(&els.lastKeyPurge)
+	if now.UnixNano()-last < int64(idempotencyPurgeInterval) {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&els.lastKeyPurge, last, now.UnixNano()) {
+		return
+	}
+	els.backgroundMu.Lock()
+	defer els.backgroundMu.Unlock()
+	if els.closed {
+		return
+	}
+	els.background.Add(1)
+	go func() {
+		defer els.background.Done()
+		defer els.observeQuery("purge_idempotency_keys", time.Now())
+		if _, err := els.db.Exec(purgeIdempotencyKeysQuery, now.Add(-els.idempotencyRetention)); err != nil {
+			logging.Warnf("unable to purge expired idempotency keys: %s", err)
+		}
+	}()
+}
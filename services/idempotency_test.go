@@ -0,0 +1,206 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/StabbyCutyou/blunderbuss/models"
+	"github.com/lib/pq"
+)
+
+func TestInsertEventsClaimsIdempotencyKeys(t *testing.T) {
+	const (
+		id1 = "00000000-0000-4000-8000-000000000001"
+		id2 = "00000000-0000-4000-8000-000000000002"
+		id3 = "00000000-0000-4000-8000-000000000003"
+		old = "00000000-0000-4000-8000-0000000000aa"
+	)
+	claimColumns := []string{"application", "key", "event_id"}
+
+	tests := []struct {
+		name   string
+		events []*models.Event
+		// claim is the expected arguments of the claim query, nil if there shouldn't be one
+		claim   []driver.Value
+		claimed [][]driver.Value
+		// lookup is the expected arguments of the query for keys already held
+		lookup    []driver.Value
+		held      [][]driver.Value
+		claimErr  error
+		wantIDs   []string
+		wantFresh []int
+		wantErr   bool
+	}{
+		{
+			name:      "no keys",
+			events:    []*models.Event{{ID: id1, Application: "billing"}, {ID: id2, Application: "billing"}},
+			wantIDs:   []string{id1, id2},
+			wantFresh: []int{0, 1},
+		},
+		{
+			name:      "new keys are claimed together, in order",
+			events:    []*models.Event{{ID: id1, Application: "search", IdempotencyKey: "a"}, {ID: id2, Application: "billing", IdempotencyKey: "b"}, {ID: id3, Application: "billing", IdempotencyKey: "a"}},
+			claim:     []driver.Value{pq.StringArray{"billing", "billing", "search"}, pq.StringArray{"a", "b", "a"}, pq.StringArray{id3, id2, id1}},
+			claimed:   [][]driver.Value{{"billing", "a", id3}, {"billing", "b", id2}, {"search", "a", id1}},
+			wantIDs:   []string{id1, id2, id3},
+			wantFresh: []int{0, 1, 2},
+		},
+		{
+			name:      "held key is replayed",
+			events:    []*models.Event{{ID: id1, Application: "billing", IdempotencyKey: "a"}, {ID: id2, Application: "billing", IdempotencyKey: "b"}, {ID: id3, Application: "billing"}},
+			claim:     []driver.Value{pq.StringArray{"billing", "billing"}, pq.StringArray{"a", "b"}, pq.StringArray{id1, id2}},
+			claimed:   [][]driver.Value{{"billing", "b", id2}},
+			lookup:    []driver.Value{pq.StringArray{"billing"}, pq.StringArray{"a"}},
+			held:      [][]driver.Value{{"billing", "a", old}},
+			wantIDs:   []string{old, id2, id3},
+			wantFresh: []int{1, 2},
+		},
+		{
+			name:      "repeated key within the batch",
+			events:    []*models.Event{{ID: id1, Application: "billing", IdempotencyKey: "a"}, {ID: id2, Application: "billing", IdempotencyKey: "a"}},
+			claim:     []driver.Value{pq.StringArray{"billing"}, pq.StringArray{"a"}, pq.StringArray{id1}},
+			claimed:   [][]driver.Value{{"billing", "a", id1}},
+			wantIDs:   []string{id1, id1},
+			wantFresh: []int{0},
+		},
+		{
+			name:      "repeated held key within the batch",
+			events:    []*models.Event{{ID: id1, Application: "billing", IdempotencyKey: "a"}, {ID: id2, Application: "billing", IdempotencyKey: "a"}},
+			claim:     []driver.Value{pq.StringArray{"billing"}, pq.StringArray{"a"}, pq.StringArray{id1}},
+			lookup:    []driver.Value{pq.StringArray{"billing"}, pq.StringArray{"a"}},
+			held:      [][]driver.Value{{"billing", "a", old}},
+			wantIDs:   []string{old, old},
+			wantFresh: []int{},
+		},
+		{
+			name:     "claim fails",
+			events:   []*models.Event{{ID: id1, Application: "billing", IdempotencyKey: "a"}},
+			claim:    []driver.Value{pq.StringArray{"billing"}, pq.StringArray{"a"}, pq.StringArray{id1}},
+			claimErr: errors.New("deadlock detected"),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			els.idempotencyRetention = time.Hour
+			// Keep the background purge of expired keys out of the way
+			els.lastKeyPurge = time.Now().Add(time.Hour).UnixNano()
+
+			mock.ExpectBegin()
+			if tt.claim != nil {
+				args := append(tt.claim, sqlmock.AnyArg(), sqlmock.AnyArg())
+				claim := mock.ExpectQuery(claimIdempotencyKeysQuery).WithArgs(args...)
+				if tt.claimErr != nil {
+					claim.WillReturnError(tt.claimErr)
+					mock.ExpectRollback()
+				} else {
+					rows := sqlmock.NewRows(claimColumns)
+					for _, r := range tt.claimed {
+						rows.AddRow(r...)
+					}
+					claim.WillReturnRows(rows)
+				}
+			}
+			if tt.lookup != nil {
+				rows := sqlmock.NewRows(claimColumns)
+				for _, r := range tt.held {
+					rows.AddRow(r...)
+				}
+				mock.ExpectQuery(getIdempotencyKeysQuery).WithArgs(tt.lookup...).WillReturnRows(rows)
+			}
+			if !tt.wantErr {
+				if len(tt.wantFresh) > 0 {
+					fresh := make([]*models.Event, len(tt.wantFresh))
+					for i, j := range tt.wantFresh {
+						fresh[i] = tt.events[j]
+					}
+					query, _ := buildInsertEventsQuery(fresh)
+					mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, int64(len(fresh))))
+				}
+				mock.ExpectCommit()
+			}
+
+			err := els.insertEvents(tt.events)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr {
+				return
+			}
+			fresh := make(map[int]bool)
+			for _, i := range tt.wantFresh {
+				fresh[i] = true
+			}
+			for i, e := range tt.events {
+				if e.ID != tt.wantIDs[i] || e.Replayed == fresh[i] {
+					t.Fatalf("event %d: expected id %s and replayed %v, got %s and %v", i, tt.wantIDs[i], !fresh[i], e.ID, e.Replayed)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteEventsRemovesIdempotencyKeys(t *testing.T) {
+	const query = `WITH deleted AS (DELETE FROM events WHERE id IN (SELECT id FROM events WHERE application = $1 LIMIT 2) RETURNING id),
+keys AS (DELETE FROM idempotency_keys WHERE event_id IN (SELECT id FROM deleted))
+SELECT count(*) FROM deleted`
+
+	tests := []struct {
+		name        string
+		batches     []int64
+		err         error
+		wantDeleted int64
+		wantErr     bool
+	}{
+		{name: "nothing to delete", batches: []int64{0}},
+		{name: "a single short batch", batches: []int64{1}, wantDeleted: 1},
+		{name: "until a batch comes up short", batches: []int64{2, 2, 1}, wantDeleted: 5},
+		{name: "until a batch is empty", batches: []int64{2, 0}, wantDeleted: 2},
+		{name: "a batch fails", batches: []int64{2}, err: errors.New("connection reset"), wantDeleted: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			els, mock := newMockService(t)
+			els.deleteBatchSize = 2
+			for _, n := range tt.batches {
+				mock.ExpectQuery(query).WithArgs("billing").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(n))
+			}
+			if tt.err != nil {
+				mock.ExpectQuery(query).WithArgs("billing").WillReturnError(tt.err)
+			}
+
+			deleted, err := els.DeleteEvents(&EventDeleteParams{EventSearchParams: EventSearchParams{Application: "billing"}})
+			if (err != nil) != tt.wantErr || deleted != tt.wantDeleted {
+				t.Fatalf("expected %d deleted and error %v, got %d and %v", tt.wantDeleted, tt.wantErr, deleted, err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCloseWaitsForKeyPurge(t *testing.T) {
+	els, mock := newMockService(t)
+	els.idempotencyRetention = time.Hour
+	mock.ExpectExec(purgeIdempotencyKeysQuery).WithArgs(sqlmock.AnyArg()).WillDelayFor(50 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	els.purgeIdempotencyKeys(time.Now())
+	els.Close()
+	// The purge has to have finished, not just started, by the time Close returns
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once closed no more purges start. Without a database one would panic
+	els.db = nil
+	els.purgeIdempotencyKeys(time.Now().Add(2 * idempotencyPurgeInterval))
+	els.Close()
+}
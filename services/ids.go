@@ -0,0 +1,25 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+)
+
+var eventIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// newEventID generates a random (version 4) UUID to identify an event
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// isEventID reports whether id looks like an id generated by newEventID
+func isEventID(id string) bool {
+	return eventIDPattern.MatchString(id)
+}
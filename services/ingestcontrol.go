@@ -0,0 +1,49 @@
+package services
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ingestPausedRetryAfter is how long clients are told to wait while ingest is paused
+const ingestPausedRetryAfter = 30 * time.Second
+
+// ErrIngestPaused is returned for writes while an operator has paused ingest
+var ErrIngestPaused = &Error{
+	Code:       CodeUnavailable,
+	Message:    "Ingest is paused",
+	RetryAfter: ingestPausedRetryAfter,
+}
+
+// IngestControl lets operators stop accepting events, for example during database
+// maintenance, without taking the rest of the service down
+type IngestControl struct {
+	paused int32
+}
+
+// IIngestControl is
+type IIngestControl interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// NewIngestControl returns a control with ingest running
+func NewIngestControl() IIngestControl {
+	return &IngestControl{}
+}
+
+// Pause stops events from being accepted until Resume is called
+func (c *IngestControl) Pause() {
+	atomic.StoreInt32(&c.paused, 1)
+}
+
+// Resume starts accepting events again
+func (c *IngestControl) Resume() {
+	atomic.StoreInt32(&c.paused, 0)
+}
+
+// Paused reports whether ingest is paused
+func (c *IngestControl) Paused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
+}
@@ -1,33 +1,85 @@
 package services
 
-import "github.com/StabbyCutyou/blunderbuss/models"
+import (
+	"time"
+
+	"github.com/StabbyCutyou/blunderbuss/models"
+)
 
 // MetricLoggingServiceConfig is
 type MetricLoggingServiceConfig struct {
 	Statsd StatsdClient
+	// Prometheus is optional, when set metrics are recorded there as well
+	Prometheus *PrometheusMetrics
+	// MaxApplications is how many applications, and separately how many API keys,
+	// get stats named after them. The rest are counted together as other
+	MaxApplications int
 }
 
 // MetricLoggingService is
 type MetricLoggingService struct {
-	statsd StatsdClient
+	statsd       StatsdClient
+	prometheus   *PrometheusMetrics
+	applications *metricNames
+	keys         *metricNames
 }
 
 type IMetricLoggingService interface {
 	RecordEvent(e *models.Event) error
+	RecordRejected(application string, reason string, n int) error
+	RecordRateLimited(kind string, key string, dropped int) error
+	RecordQuery(query string, d time.Duration) error
 }
 
 // NewMetricLoggingService is
 func NewMetricLoggingService(cfg *MetricLoggingServiceConfig) (IMetricLoggingService, error) {
 	return &MetricLoggingService{
-		statsd: cfg.Statsd,
+		statsd:       cfg.Statsd,
+		prometheus:   cfg.Prometheus,
+		applications: newMetricNames(cfg.MaxApplications),
+		keys:         newMetricNames(cfg.MaxApplications),
 	}, nil
 }
 
 // RecordEvent is
 func (m *MetricLoggingService) RecordEvent(e *models.Event) error {
+	m.prometheus.RecordIngested(e.Application, 1)
 	return m.statsd.Incr(eventToCountKey(e), 1)
 }
 
+// RecordRejected counts n events refused with the error code reason. application
+// should be empty unless the caller was authorized to write to it, so that it can't
+// be used to fill our stats with made up names. Even then, only MaxApplications
+// applications are named
+func (m *MetricLoggingService) RecordRejected(application string, reason string, n int) error {
+	m.prometheus.RecordRejected(application, reason, n)
+	id := "rejected." + reason
+	if application != "" {
+		id += "." + m.applications.name(application)
+	}
+	return m.statsd.Incr(id, int64(n))
+}
+
+// RecordQuery records how long the named database query took
+func (m *MetricLoggingService) RecordQuery(query string, d time.Duration) error {
+	m.prometheus.ObserveQuery(query, d)
+	return m.statsd.PrecisionTiming("db."+query, d)
+}
+
+// RecordRateLimited counts events dropped by a rate limit. IP limits are counted
+// without the address, and only MaxApplications applications and API keys are
+// named, to keep the number of distinct stats bounded
+func (m *MetricLoggingService) RecordRateLimited(kind string, key string, dropped int) error {
+	id := "ratelimited." + kind
+	switch kind {
+	case RateLimitApplication:
+		id += "." + m.applications.name(key)
+	case RateLimitAPIKey:
+		id += "." + m.keys.name(key)
+	}
+	return m.statsd.Incr(id, int64(dropped))
+}
+
 func eventToCountKey(e *models.Event) string {
 	return e.Application + "." + e.Type + "." + e.Message
 }
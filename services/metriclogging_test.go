@@ -0,0 +1,87 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeStatsd remembers the stats incremented, in order
+type fakeStatsd struct {
+	StatsdClient
+	incrs []string
+}
+
+func (f *fakeStatsd) Incr(id string, value int64) error {
+	f.incrs = append(f.incrs, id)
+	return nil
+}
+
+func (f *fakeStatsd) PrecisionTiming(id string, value time.Duration) error {
+	return nil
+}
+
+func TestMetricNamesAreCapped(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(m IMetricLoggingService)
+		want   []string
+	}{
+		{
+			name: "rate limited applications",
+			record: func(m IMetricLoggingService) {
+				for _, app := range []string{"billing", "search", "checkout", "billing"} {
+					m.RecordRateLimited(RateLimitApplication, app, 1)
+				}
+			},
+			want: []string{"ratelimited.application.billing", "ratelimited.application.search", "ratelimited.application.other", "ratelimited.application.billing"},
+		},
+		{
+			name: "rate limited keys",
+			record: func(m IMetricLoggingService) {
+				for _, k := range []string{"k1", "k2", "k3"} {
+					m.RecordRateLimited(RateLimitAPIKey, k, 1)
+				}
+			},
+			want: []string{"ratelimited.api_key.k1", "ratelimited.api_key.k2", "ratelimited.api_key.other"},
+		},
+		{
+			name: "keys and applications are capped separately",
+			record: func(m IMetricLoggingService) {
+				m.RecordRateLimited(RateLimitApplication, "billing", 1)
+				m.RecordRateLimited(RateLimitApplication, "search", 1)
+				m.RecordRateLimited(RateLimitAPIKey, "k1", 1)
+			},
+			want: []string{"ratelimited.application.billing", "ratelimited.application.search", "ratelimited.api_key.k1"},
+		},
+		{
+			name: "rate limited ips are never named",
+			record: func(m IMetricLoggingService) {
+				m.RecordRateLimited(RateLimitIP, "10.0.0.1", 1)
+			},
+			want: []string{"ratelimited.ip"},
+		},
+		{
+			name: "rejections",
+			record: func(m IMetricLoggingService) {
+				for _, app := range []string{"billing", "", "search", "checkout"} {
+					m.RecordRejected(app, "validation_failed", 1)
+				}
+			},
+			want: []string{"rejected.validation_failed.billing", "rejected.validation_failed", "rejected.validation_failed.search", "rejected.validation_failed.other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &fakeStatsd{}
+			m, err := NewMetricLoggingService(&MetricLoggingServiceConfig{Statsd: stats, MaxApplications: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.record(m)
+			if !reflect.DeepEqual(stats.incrs, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, stats.incrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import "sync"
+
+// metricNames caps how many distinct names, such as applications, are used in
+// metrics. The first max names seen keep their own, any others share
+// otherApplicationLabel, so that names coming from clients can't create any number
+// of series or stats
+type metricNames struct {
+	max  int
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newMetricNames(max int) *metricNames {
+	if max <= 0 {
+		max = DefaultMaxApplicationLabels
+	}
+	return &metricNames{max: max, seen: make(map[string]bool)}
+}
+
+// name returns s if it has a name of its own, and otherApplicationLabel if not. An
+// empty s means it wasn't authorized, and is never given a name
+func (n *metricNames) name(s string) string {
+	if s == "" {
+		return otherApplicationLabel
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.seen[s] {
+		return s
+	}
+	if len(n.seen) >= n.max {
+		return otherApplicationLabel
+	}
+	n.seen[s] = true
+	return s
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// prometheusNamespace prefixes the name of every metric blunderbuss defines itself
+const prometheusNamespace = "blunderbuss"
+
+// DefaultMaxApplicationLabels is used when PrometheusConfig.MaxApplications or
+// MetricLoggingServiceConfig.MaxApplications is not set
+const DefaultMaxApplicationLabels = 100
+
+// otherApplicationLabel is the application label of events from applications past
+// the limit, and of events refused before their application was authorized. Stats
+// use it in place of names past the limit too
+const otherApplicationLabel = "other"
+
+// PrometheusConfig is
+type PrometheusConfig struct {
+	// DB is optional, when set its connection pool stats are exported
+	DB *sqlx.DB
+	// MaxApplications is how many applications get a label value of their own.
+	// When keys aren't enforced application names come straight from clients, so
+	// without a limit they could create any number of series
+	MaxApplications int
+}
+
+// PrometheusMetrics holds the metrics blunderbuss exports about itself for
+// Prometheus to scrape. A nil *PrometheusMetrics is valid, and records nothing,
+// so callers don't need to check whether it is enabled
+type PrometheusMetrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	ingested        *prometheus.CounterVec
+	rejected        *prometheus.CounterVec
+	queryDuration   *prometheus.HistogramVec
+
+	applications *metricNames
+}
+
+// NewPrometheusMetrics will register every metric, along with the Go runtime and
+// process metrics, on a registry of its own
+func NewPrometheusMetrics(cfg *PrometheusConfig) (*PrometheusMetrics, error) {
+	p := &PrometheusMetrics{
+		applications: newMetricNames(cfg.MaxApplications),
+		registry:     prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "How long HTTP requests took to serve, by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		ingested: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "events_ingested_total",
+			Help:      "Events stored, by application. Applications past the limit on labels are counted as other.",
+		}, []string{"application"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "events_rejected_total",
+			Help:      "Events refused, by application and the code of the error they were refused with. The application is other when the event was refused before its application was authorized, or is past the limit on labels.",
+		}, []string{"application", "reason"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "How long database queries took, by query.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"query"}),
+	}
+
+	cs := []prometheus.Collector{
+		p.requests,
+		p.requestDuration,
+		p.ingested,
+		p.rejected,
+		p.queryDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	}
+	if cfg.DB != nil {
+		cs = append(cs, collectors.NewDBStatsCollector(cfg.DB.DB, prometheusNamespace))
+	}
+	for _, c := range cs {
+		if err := p.registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (p *PrometheusMetrics) Handler() http.Handler {
+	if p == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request
+func (p *PrometheusMetrics) ObserveRequest(route string, method string, status int, d time.Duration) {
+	if p == nil {
+		return
+	}
+	method = metricMethod(method)
+	p.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	p.requestDuration.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+// ObserveQuery records how long the named database query took
+func (p *PrometheusMetrics) ObserveQuery(query string, d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.queryDuration.WithLabelValues(query).Observe(d.Seconds())
+}
+
+// RecordIngested counts n events stored for application
+func (p *PrometheusMetrics) RecordIngested(application string, n int) {
+	if p == nil {
+		return
+	}
+	p.ingested.WithLabelValues(p.applications.name(application)).Add(float64(n))
+}
+
+// RecordRejected counts n events for application refused with the error code reason
+func (p *PrometheusMetrics) RecordRejected(application string, reason string, n int) {
+	if p == nil {
+		return
+	}
+	p.rejected.WithLabelValues(p.applications.name(application), reason).Add(float64(n))
+}
+
+// metricMethod keeps the method label to the methods we serve, as the method of a
+// request that matched no route could be anything
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodPatch:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusApplicationLabels(t *testing.T) {
+	p, err := NewPrometheusMetrics(&PrometheusConfig{MaxApplications: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RecordIngested("billing", 1)
+	p.RecordIngested("search", 2)
+	// Past the limit, so counted as other
+	p.RecordIngested("made-up-1", 3)
+	p.RecordIngested("made-up-2", 4)
+	// Already labelled, so keeps its name
+	p.RecordIngested("billing", 5)
+	// Refused before it was authorized
+	p.RecordRejected("", "forbidden", 6)
+	p.RecordRejected("search", "validation_failed", 7)
+
+	want := `
+# HELP blunderbuss_events_ingested_total Events stored, by application. Applications past the limit on labels are counted as other.
+# TYPE blunderbuss_events_ingested_total counter
+blunderbuss_events_ingested_total{application="billing"} 6
+blunderbuss_events_ingested_total{application="other"} 7
+blunderbuss_events_ingested_total{application="search"} 2
+`
+	if err = testutil.CollectAndCompare(p.ingested, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(p.rejected.WithLabelValues("other", "forbidden")); got != 6 {
+		t.Fatalf("expected 6 unauthorized rejections under other, got %v", got)
+	}
+	if got := testutil.ToFloat64(p.rejected.WithLabelValues("search", "validation_failed")); got != 7 {
+		t.Fatalf("expected 7 rejections for search, got %v", got)
+	}
+	if n := testutil.CollectAndCount(p.rejected); n != 2 {
+		t.Fatalf("expected 2 rejected series, got %d", n)
+	}
+
+	// A nil *PrometheusMetrics records nothing, and doesn't panic
+	var none *PrometheusMetrics
+	none.RecordIngested("billing", 1)
+	none.RecordRejected("", "forbidden", 1)
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RateLimitApplication limits are keyed by the application an event claims
+	RateLimitApplication = "application"
+	// RateLimitAPIKey limits are keyed by the id of the API key used
+	RateLimitAPIKey = "api_key"
+	// RateLimitIP limits are keyed by the client's IP address
+	RateLimitIP = "ip"
+)
+
+// bucketIdleTimeout is how long an unused bucket is kept before it is forgotten
+const bucketIdleTimeout = 10 * time.Minute
+
+// RateLimit is a token bucket allowing Rate events per second, with bursts of up
+// to Burst. A zero Rate means unlimited
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitServiceConfig is
+type RateLimitServiceConfig struct {
+	MetricService IMetricLoggingService
+	Application   RateLimit
+	APIKey        RateLimit
+	IP            RateLimit
+	// ApplicationOverrides replace the Application limit for specific applications
+	ApplicationOverrides map[string]RateLimit
+}
+
+// RateLimitService is
+type RateLimitService struct {
+	metricService IMetricLoggingService
+	limits        map[string]RateLimit
+	overrides     map[string]RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// IRateLimitService is
+type IRateLimitService interface {
+	// Allow takes n tokens from the bucket for key of the given kind. If there
+	// aren't enough, it returns false and how long until there will be
+	Allow(kind string, key string, n int) (bool, time.Duration)
+}
+
+type tokenBucket struct {
+	tokens   float64
+	limit    RateLimit
+	lastSeen time.Time
+}
+
+// normalized fills in a missing burst with one second's worth of events
+func (l RateLimit) normalized() RateLimit {
+	if l.Burst < 1 {
+		l.Burst = int(math.Max(1, math.Ceil(l.Rate)))
+	}
+	return l
+}
+
+// NewRateLimitService is
+func NewRateLimitService(cfg *RateLimitServiceConfig) (IRateLimitService, error) {
+	overrides := make(map[string]RateLimit, len(cfg.ApplicationOverrides))
+	for app, l := range cfg.ApplicationOverrides {
+		overrides[app] = l.normalized()
+	}
+	return &RateLimitService{
+		metricService: cfg.MetricService,
+		limits: map[string]RateLimit{
+			RateLimitApplication: cfg.Application.normalized(),
+			RateLimitAPIKey:      cfg.APIKey.normalized(),
+			RateLimitIP:          cfg.IP.normalized(),
+		},
+		overrides: overrides,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// Allow will
+func (s *RateLimitService) Allow(kind string, key string, n int) (bool, time.Duration) {
+	limit := s.limits[kind]
+	if kind == RateLimitApplication {
+		if o, ok := s.overrides[key]; ok {
+			limit = o
+		}
+	}
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	s.sweep(now)
+	id := kind + ":" + key
+	b, ok := s.buckets[id]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), limit: limit, lastSeen: now}
+		s.buckets[id] = b
+	}
+	allowed, wait := b.take(now, n)
+	s.mu.Unlock()
+
+	if !allowed && s.metricService != nil {
+		s.metricService.RecordRateLimited(kind, key, n)
+	}
+	return allowed, wait
+}
+
+// sweep forgets buckets that haven't been used in a while, so that keying by
+// something unbounded like IP address doesn't grow forever. The caller must hold mu
+func (s *RateLimitService) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < bucketIdleTimeout {
+		return
+	}
+	s.lastSweep = now
+	for id, b := range s.buckets {
+		if now.Sub(b.lastSeen) > bucketIdleTimeout {
+			delete(s.buckets, id)
+		}
+	}
+}
+
+func (b *tokenBucket) take(now time.Time, n int) (bool, time.Duration) {
+	burst := float64(b.limit.Burst)
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.lastSeen).Seconds()*b.limit.Rate)
+	b.lastSeen = now
+
+	need := float64(n)
+	// A request larger than the burst could never be covered, so it is let through
+	// once the bucket is full, and the bucket goes into debt for the rest. Requests
+	// after it then wait for the debt to be paid off
+	if b.tokens >= need || (need > burst && b.tokens >= burst) {
+		b.tokens -= need
+		return true, 0
+	}
+	missing := math.Min(need, burst) - b.tokens
+	return false, time.Duration(missing / b.limit.Rate * float64(time.Second))
+}
+
+// ParseRateLimitOverrides reads per application limits in the form
+// "app=rate:burst,otherapp=rate:burst"
+func ParseRateLimitOverrides(s string) (map[string]RateLimit, error) {
+	overrides := make(map[string]RateLimit)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid rate limit override %q, expected app=rate:burst", entry)
+		}
+		limit := strings.SplitN(parts[1], ":", 2)
+		rate, err := strconv.ParseFloat(limit[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid rate in rate limit override %q", entry)
+		}
+		burst := 0
+		if len(limit) == 2 {
+			if burst, err = strconv.Atoi(limit[1]); err != nil {
+				return nil, fmt.Errorf("Invalid burst in rate limit override %q", entry)
+			}
+		}
+		overrides[parts[0]] = RateLimit{Rate: rate, Burst: burst}
+	}
+	return overrides, nil
+}
+
+// NewRateLimitedError returns an error telling the caller to retry after wait
+func NewRateLimitedError(kind string, wait time.Duration) *Error {
+	return &Error{
+		Code:       CodeRateLimited,
+		Message:    "Rate limit exceeded for " + kind,
+		RetryAfter: wait,
+		Details:    map[string]interface{}{"limit": kind, "retry_after_seconds": retryAfterSeconds(wait)},
+	}
+}
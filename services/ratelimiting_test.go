@@ -0,0 +1,105 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketTake(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	limit := RateLimit{Rate: 10, Burst: 20}
+
+	type take struct {
+		after    time.Duration
+		n        int
+		want     bool
+		wantWait time.Duration
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{name: "within the burst", takes: []take{{n: 5, want: true}, {n: 15, want: true}}},
+		{name: "over the burst", takes: []take{{n: 15, want: true}, {n: 10, wantWait: 500 * time.Millisecond}}},
+		{name: "refills over time", takes: []take{{n: 20, want: true}, {after: time.Second, n: 10, want: true}, {n: 1, wantWait: 100 * time.Millisecond}}},
+		{name: "refill is capped at the burst", takes: []take{{n: 20, want: true}, {after: time.Minute, n: 20, want: true}, {n: 1, wantWait: 100 * time.Millisecond}}},
+		{name: "larger than the burst when full", takes: []take{{n: 50, want: true}, {n: 1, wantWait: 3100 * time.Millisecond}}},
+		{name: "larger than the burst when not full", takes: []take{{n: 1, want: true}, {n: 50, wantWait: 100 * time.Millisecond}}},
+		{name: "debt is paid off before the next take", takes: []take{{n: 50, want: true}, {after: 3 * time.Second, n: 1, wantWait: 100 * time.Millisecond}, {after: 100 * time.Millisecond, n: 1, want: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &tokenBucket{tokens: float64(limit.Burst), limit: limit, lastSeen: start}
+			now := start
+			for i, tk := range tt.takes {
+				now = now.Add(tk.after)
+				ok, wait := b.take(now, tk.n)
+				// Allow for floating point error in the wait
+				if ok != tk.want || (wait-tk.wantWait).Abs() > time.Millisecond {
+					t.Fatalf("take %d of %d: expected %v, %s, got %v, %s", i, tk.n, tk.want, tk.wantWait, ok, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitServiceAllow(t *testing.T) {
+	s, err := NewRateLimitService(&RateLimitServiceConfig{
+		Application:          RateLimit{Rate: 1, Burst: 2},
+		APIKey:               RateLimit{Rate: 1},
+		ApplicationOverrides: map[string]RateLimit{"billing": {Rate: 1, Burst: 5}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		kind string
+		key  string
+		n    int
+		want bool
+	}{
+		{name: "application within its burst", kind: RateLimitApplication, key: "search", n: 2, want: true},
+		{name: "application past its burst", kind: RateLimitApplication, key: "search", n: 1},
+		{name: "buckets are kept per key", kind: RateLimitApplication, key: "checkout", n: 2, want: true},
+		{name: "override within its burst", kind: RateLimitApplication, key: "billing", n: 5, want: true},
+		{name: "burst defaults to a second of the rate", kind: RateLimitAPIKey, key: "k1", n: 1, want: true},
+		{name: "past the default burst", kind: RateLimitAPIKey, key: "k1", n: 1},
+		{name: "no limit set", kind: RateLimitIP, key: "10.0.0.1", n: 1000, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, _ := s.Allow(tt.kind, tt.key, tt.n); ok != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, ok)
+			}
+		})
+	}
+}
+
+func TestParseRateLimitOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]RateLimit
+		wantErr bool
+	}{
+		{name: "empty", s: "", want: map[string]RateLimit{}},
+		{name: "rate and burst", s: "billing=10:50, search=2.5", want: map[string]RateLimit{"billing": {Rate: 10, Burst: 50}, "search": {Rate: 2.5}}},
+		{name: "missing rate", s: "billing", wantErr: true},
+		{name: "bad rate", s: "billing=fast", wantErr: true},
+		{name: "bad burst", s: "billing=10:lots", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRateLimitOverrides(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ type StatsdClient interface {
 	IncrGauge(id string, value int64) error
 	DecrGauge(id string, value int64) error
 	SetGauge(id string, value int64) error
+	Close() error
 }
 
 // RealStatsdClient will report stats to a StatsD compatible service
@@ -98,6 +99,11 @@ func (c *RealStatsdClient) SetGauge(id string, value int64) error {
 	return c.client.Gauge(id, value)
 }
 
+// Close flushes any buffered stats and closes the socket
+func (c *RealStatsdClient) Close() error {
+	return c.client.Close()
+}
+
 // NOOPStatsdClient is to sub in when we don't want to write stats
 type NOOPStatsdClient struct {
 }
@@ -141,3 +147,8 @@ func (c *NOOPStatsdClient) DecrGauge(id string, value int64) error {
 func (c *NOOPStatsdClient) SetGauge(id string, value int64) error {
 	return nil
 }
+
+// Close does nothing
+func (c *NOOPStatsdClient) Close() error {
+	return nil
+}
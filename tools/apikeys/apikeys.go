@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/StabbyCutyou/blunderbuss/boot"
+)
+
+// apikeys creates projects and the API keys used to access them
+//
+//	apikeys -project checkout -apps checkout-web,checkout-worker
+//	apikeys -project-id <id> -scope ingest
+//	apikeys -project-id <id> -origins https://shop.example.com
+//	apikeys -revoke <key id>
+func main() {
+	project := flag.String("project", "", "name of a new project to create")
+	projectID := flag.String("project-id", "", "id of the project to create a key for")
+	apps := flag.String("apps", "", "comma separated applications for the project or key")
+	scope := flag.String("scope", "ingest", "scope of the key, ingest, read_write, admin or public")
+	origins := flag.String("origins", "", "comma separated web origins the project's public keys may be used from")
+	revoke := flag.String("revoke", "", "id of a key to revoke")
+	flag.Parse()
+
+	bp, err := boot.Boot()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var applications []string
+	if *apps != "" {
+		applications = strings.Split(*apps, ",")
+	}
+
+	switch {
+	case *revoke != "":
+		if err := bp.KeyService.RevokeAPIKey(*revoke); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("revoked key %s\n", *revoke)
+	case *project != "":
+		p, err := bp.KeyService.CreateProject(*project, applications)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("created project %s (%s) for %s\n", p.Name, p.ID, strings.Join(p.Applications, ", "))
+	case *projectID != "" && *origins != "":
+		if err := bp.KeyService.SetAllowedOrigins(*projectID, strings.Split(*origins, ",")); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("set allowed origins for project %s to %s\n", *projectID, *origins)
+	case *projectID != "":
+		raw, k, err := bp.KeyService.CreateAPIKey(*projectID, *scope, applications)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("created %s key %s for %s\n", k.Scope, k.ID, strings.Join(k.Applications, ", "))
+		fmt.Printf("key: %s\n", raw)
+	default:
+		flag.Usage()
+	}
+}
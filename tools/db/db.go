@@ -9,13 +9,49 @@ import (
 
 const schema = `
 CREATE TABLE events (
+    id UUID PRIMARY KEY,
     application TEXT,
     type TEXT,
     message TEXT,
     context JSON,
     stack_trace TEXT,
-    created_at TIMESTAMPTZ
-)`
+    created_at TIMESTAMPTZ,
+    truncated_fields TEXT[]
+);
+
+-- Searches page through events in (created_at, id) order, usually for a single
+-- application
+CREATE INDEX events_created_at_id ON events (created_at, id);
+CREATE INDEX events_application_created_at_id ON events (application, created_at, id);
+
+CREATE TABLE projects (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    applications TEXT[] NOT NULL,
+    allowed_origins TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY,
+    project_id UUID NOT NULL REFERENCES projects (id),
+    key_hash TEXT NOT NULL UNIQUE,
+    scope TEXT NOT NULL,
+    applications TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE TABLE idempotency_keys (
+    application TEXT NOT NULL,
+    key TEXT NOT NULL,
+    event_id UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (application, key)
+);
+
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
+CREATE INDEX idempotency_keys_event_id ON idempotency_keys (event_id)`
 
 func main() {
 	db, err := sqlx.Open("postgres", "user=stabby dbname=bbus sslmode=disable")